@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const accessControlEnvVarName string = "access_control"
+
+// Per-type settings under this key are applied to types which don't have their own settings.
+const anyTypeKey = "*"
+
+const accessPublic = "public"
+const accessAuthenticated = "authenticated"
+const accessRestricted = "restricted"
+
+const userGroupsPageSize = 100
+
+// Superadmin, admin and member. The state 3 is a join request, such users are not members yet.
+const maxGroupMemberState = 2
+
+/*
+The `access_control` env var contains a JSON object where keys are types and values are rules, e.g.
+
+	{
+	  "core": {"access": "public"},
+	  "profiles": {"access": "authenticated"},
+	  "beta": {"access": "restricted", "groups": ["beta-testers"], "metadata_flag": "beta"}
+	}
+
+A restricted type is available to members of any of the listed groups (by ID or by name) and to users whose
+metadata contains `true` under the `metadata_flag` key. Types without a rule are public, unless the `*` rule is set.
+*/
+type accessRule struct {
+	Access       string   `json:"access"`
+	Groups       []string `json:"groups,omitempty"`
+	MetadataFlag string   `json:"metadata_flag,omitempty"`
+}
+
+func parseAccessRules(value string) (map[string]accessRule, error) {
+	var rules map[string]accessRule
+	err := json.Unmarshal([]byte(value), &rules)
+	if err != nil {
+		return nil, err
+	}
+	for typeName, rule := range rules {
+		if err = validateAccessRule(rule); err != nil {
+			return nil, fmt.Errorf("`%s`: %w", typeName, err)
+		}
+	}
+	return rules, nil
+}
+
+func validateAccessRule(rule accessRule) error {
+	switch rule.Access {
+	case accessPublic, accessAuthenticated, accessRestricted:
+		return nil
+	default:
+		return fmt.Errorf("unknown access %q", rule.Access)
+	}
+}
+
+func accessRuleFor(rules map[string]accessRule, typeName string) accessRule {
+	if rule, ok := rules[typeName]; ok {
+		return rule
+	}
+	if rule, ok := rules[anyTypeKey]; ok {
+		return rule
+	}
+	return accessRule{Access: accessPublic}
+}
+
+// Administrative RPCs are called with the HTTP key only, such calls don't have a user in the context.
+func checkServerToServer(ctx context.Context) error {
+	if userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); userId != "" {
+		return runtime.NewError("The RPC is available only to server-to-server calls", permissionDeniedCode)
+	}
+	return nil
+}
+
+func checkAccess(ctx context.Context, nk runtime.NakamaModule, rules map[string]accessRule, typeName string) error {
+	allowed, err := isAccessAllowed(ctx, nk, accessRuleFor(rules, typeName))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return runtime.NewError(fmt.Sprintf("Access to `%s` is denied", typeName), permissionDeniedCode)
+	}
+	return nil
+}
+
+func isAccessAllowed(ctx context.Context, nk runtime.NakamaModule, rule accessRule) (bool, error) {
+	if rule.Access == accessPublic {
+		return true, nil
+	}
+	userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userId == "" {
+		return false, nil
+	}
+	if rule.Access == accessAuthenticated {
+		return true, nil
+	}
+
+	if rule.MetadataFlag != "" {
+		flagged, err := hasMetadataFlag(ctx, nk, userId, rule.MetadataFlag)
+		if err != nil || flagged {
+			return flagged, err
+		}
+	}
+	if len(rule.Groups) > 0 {
+		return isMemberOfAnyGroup(ctx, nk, userId, rule.Groups)
+	}
+	return false, nil
+}
+
+func hasMetadataFlag(ctx context.Context, nk runtime.NakamaModule, userId string, flag string) (bool, error) {
+	users, err := nk.UsersGetId(ctx, []string{userId}, nil)
+	if err != nil {
+		return false, runtime.NewError("Unable to check access", internalErrorCode)
+	}
+	if len(users) == 0 || users[0].Metadata == "" {
+		return false, nil
+	}
+	var metadata map[string]interface{}
+	if err = json.Unmarshal([]byte(users[0].Metadata), &metadata); err != nil {
+		return false, nil
+	}
+	value, _ := metadata[flag].(bool)
+	return value, nil
+}
+
+func isMemberOfAnyGroup(ctx context.Context, nk runtime.NakamaModule, userId string, groups []string) (bool, error) {
+	cursor := ""
+	for {
+		userGroups, nextCursor, err := nk.UserGroupsList(ctx, userId, userGroupsPageSize, nil, cursor)
+		if err != nil {
+			return false, runtime.NewError("Unable to check access", internalErrorCode)
+		}
+		for _, userGroup := range userGroups {
+			if userGroup.State == nil || userGroup.State.Value > maxGroupMemberState || userGroup.Group == nil {
+				continue
+			}
+			for _, group := range groups {
+				if group == userGroup.Group.Id || group == userGroup.Group.Name {
+					return true, nil
+				}
+			}
+		}
+		if nextCursor == "" {
+			return false, nil
+		}
+		cursor = nextCursor
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+)
+
+func TestThatAuthenticatedTypeIsDeniedWithoutUser(t *testing.T) {
+	setConfigValue(t, accessControlEnvVarName, `{"custom": {"access": "authenticated"}}`)
+	db, _ := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, mockNakamaModule, buildPayload("custom", "5.0.0", nil))
+	assert.Equal(t, "{}", res)
+	assertErrorCode(t, err, permissionDeniedCode)
+}
+
+func TestThatAuthenticatedTypeIsServedToUser(t *testing.T) {
+	setConfigValue(t, accessControlEnvVarName, `{"custom": {"access": "authenticated"}}`)
+	db, _ := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+
+	res, err := RpcFileDownloader(userContext("user-1"), buildLoggerMock(), db, mockNakamaModule, buildPayload("custom", "5.0.0", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"custom\": \"5.0.0\"}", *unmarshalResponse(res).Content)
+}
+
+func TestThatDefaultRuleIsAppliedToTypesWithoutRule(t *testing.T) {
+	setConfigValue(t, accessControlEnvVarName, `{"*": {"access": "authenticated"}, "core": {"access": "public"}}`)
+	db, _ := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+
+	_, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, mockNakamaModule, buildPayload("custom", "5.0.0", nil))
+	assertErrorCode(t, err, permissionDeniedCode)
+	_, err = RpcFileDownloader(context.Background(), buildLoggerMock(), db, mockNakamaModule, buildPayload("core", "1.0.0", nil))
+	assert.NoError(t, err)
+}
+
+func TestThatRestrictedTypeIsServedToGroupMember(t *testing.T) {
+	setConfigValue(t, accessControlEnvVarName, `{"custom": {"access": "restricted", "groups": ["testers"]}}`)
+	db, _ := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+	mockNakamaModule.
+		On("UserGroupsList", mock.Anything, "user-1", userGroupsPageSize, (*int)(nil), "").
+		Return([]*api.UserGroupList_UserGroup{
+			{Group: &api.Group{Id: "group-1", Name: "players"}, State: wrapperspb.Int32(2)},
+		}, "next", nil).
+		Once()
+	mockNakamaModule.
+		On("UserGroupsList", mock.Anything, "user-1", userGroupsPageSize, (*int)(nil), "next").
+		Return([]*api.UserGroupList_UserGroup{
+			{Group: &api.Group{Id: "group-2", Name: "testers"}, State: wrapperspb.Int32(2)},
+		}, "", nil).
+		Once()
+
+	_, err := RpcFileDownloader(userContext("user-1"), buildLoggerMock(), db, mockNakamaModule, buildPayload("custom", "5.0.0", nil))
+	assert.NoError(t, err)
+}
+
+func TestThatRestrictedTypeIsDeniedToJoinRequester(t *testing.T) {
+	setConfigValue(t, accessControlEnvVarName, `{"custom": {"access": "restricted", "groups": ["group-2"]}}`)
+	db, _ := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+	mockNakamaModule.
+		On("UserGroupsList", mock.Anything, "user-1", userGroupsPageSize, (*int)(nil), "").
+		Return([]*api.UserGroupList_UserGroup{
+			{Group: &api.Group{Id: "group-2", Name: "testers"}, State: wrapperspb.Int32(3)},
+		}, "", nil).
+		Once()
+
+	_, err := RpcFileDownloader(userContext("user-1"), buildLoggerMock(), db, mockNakamaModule, buildPayload("custom", "5.0.0", nil))
+	assertErrorCode(t, err, permissionDeniedCode)
+}
+
+func TestThatRestrictedTypeIsServedToUserWithMetadataFlag(t *testing.T) {
+	setConfigValue(t, accessControlEnvVarName, `{"custom": {"access": "restricted", "metadata_flag": "beta"}}`)
+	db, _ := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+	mockNakamaModule.
+		On("UsersGetId", mock.Anything, []string{"user-1"}, []string(nil)).
+		Return([]*api.User{{Id: "user-1", Metadata: `{"beta": true}`}}, nil).
+		Once()
+
+	_, err := RpcFileDownloader(userContext("user-1"), buildLoggerMock(), db, mockNakamaModule, buildPayload("custom", "5.0.0", nil))
+	assert.NoError(t, err)
+}
+
+func TestThatListingOmitsDeniedTypes(t *testing.T) {
+	setConfigValue(t, accessControlEnvVarName, `{"custom": {"access": "authenticated"}}`)
+	db, _ := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+
+	res, err := RpcFileList(context.Background(), buildLoggerMock(), db, mockNakamaModule, "")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"types": [{"type": "core", "versions": ["1.0.0"]}]}`, res)
+
+	res, err = RpcFileList(userContext("user-1"), buildLoggerMock(), db, mockNakamaModule, "")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"types": [{"type": "core", "versions": ["1.0.0"]}, {"type": "custom", "versions": ["5.0.0"]}]}`, res)
+}
+
+func TestThatListingOfDeniedTypeFails(t *testing.T) {
+	setConfigValue(t, accessControlEnvVarName, `{"custom": {"access": "authenticated"}}`)
+	db, _ := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+
+	res, err := RpcFileList(context.Background(), buildLoggerMock(), db, mockNakamaModule, `{"type": "custom"}`)
+	assert.Equal(t, "{}", res)
+	assertErrorCode(t, err, permissionDeniedCode)
+}
+
+func userContext(userId string) context.Context {
+	return context.WithValue(context.Background(), runtime.RUNTIME_CTX_USER_ID, userId)
+}
+
+func assertErrorCode(t *testing.T, err error, code int) {
+	var runtimeErr *runtime.Error
+	if assert.ErrorAs(t, err, &runtimeErr) {
+		assert.Equal(t, code, runtimeErr.Code)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"os"
+)
+
+// Promotion moves the live alias to a new version and keeps the replaced one as previous for a quick rollback.
+const liveAlias = "live"
+const previousAlias = "previous"
+
+type AliasRequest struct {
+	Type  string `json:"type"`
+	Alias string `json:"alias"`
+	// The alias is deleted if the version is omitted.
+	Version *string `json:"version,omitempty"`
+	Reason  string  `json:"reason"`
+}
+
+type PromoteRequest struct {
+	Type    string `json:"type"`
+	Version string `json:"version"`
+	Reason  string `json:"reason"`
+}
+
+type PromoteResponse struct {
+	Type     string  `json:"type"`
+	Live     string  `json:"live"`
+	Previous *string `json:"previous"`
+}
+
+/*
+Returns the version which the alias points to. A file with the same name as the alias takes precedence,
+so an alias can never shadow an existing version.
+*/
+func resolveVersion(ctx context.Context, logger runtime.Logger, db *sql.DB, cfg *moduleConfig, typeName string, version string) (string, error) {
+	snapshot, err := currentContentMetadata(ctx, logger, db)
+	if err != nil {
+		return "", err
+	}
+	target, ok := snapshot.alias(typeName, version)
+	if !ok {
+		return version, nil
+	}
+	exists, err := versionExists(cfg, typeName, version)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return version, nil
+	}
+	return target, nil
+}
+
+func versionExists(cfg *moduleConfig, typeName string, version string) (bool, error) {
+	filePath, err := buildFilePath(cfg, typeName, version)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Aliases can point only to existing versions which are not deleted.
+func checkAliasTarget(ctx context.Context, logger runtime.Logger, db *sql.DB, cfg *moduleConfig, typeName string, version string) error {
+	err := validateName("version", version)
+	if err != nil {
+		return err
+	}
+	metadata, err := versionMetadataFor(ctx, logger, db, typeName, version)
+	if err != nil {
+		return err
+	}
+	if metadata.RemovedAt != nil {
+		return removedError(typeName, version, metadata.Replacement)
+	}
+	exists, err := versionExists(cfg, typeName, version)
+	if err != nil {
+		logger.Error("Unable to check version %s of %s: %v", version, typeName, err)
+		return runtime.NewError("Unable to check the version", internalErrorCode)
+	}
+	if !exists {
+		return runtime.NewError(fmt.Sprintf("Version `%s` of `%s` not found", version, typeName), notFoundCode)
+	}
+	return nil
+}
+
+// Hashes of versions are recorded to the audit log of alias changes, so it shows what content players got.
+func versionHash(cfg *moduleConfig, typeName string, version string) *string {
+	filePath, err := buildFilePath(cfg, typeName, version)
+	if err != nil {
+		return nil
+	}
+	key, encrypted := encryptionKeyFor(cfg.EncryptionKeys, typeName)
+	hash, err := readContentHash(filePath, typeName, key, encrypted)
+	if err != nil {
+		return nil
+	}
+	return hash
+}
+
+// Points an alias to a version, or deletes it. Use DownloaderPromote to change the live version.
+func RpcDownloaderSetAlias(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	err := checkServerToServer(ctx)
+	if err != nil {
+		return "{}", err
+	}
+	var req AliasRequest
+	err = json.Unmarshal([]byte(payload), &req)
+	if err != nil {
+		logger.Info("Unable to deserialize request %v", err)
+		return "{}", runtime.NewError("Unable to deserialize request", invalidArgumentCode)
+	}
+	err = validateName("type", req.Type)
+	if err != nil {
+		return "{}", err
+	}
+	err = validateName("alias", req.Alias)
+	if err != nil {
+		return "{}", err
+	}
+	if req.Alias == liveAlias || req.Alias == previousAlias {
+		return "{}", runtime.NewError(fmt.Sprintf("`%s` is managed by DownloaderPromote, it can't be set directly", req.Alias), invalidArgumentCode)
+	}
+	cfg := currentConfig()
+	exists, err := versionExists(cfg, req.Type, req.Alias)
+	if err != nil {
+		logger.Error("Unable to check version %s of %s: %v", req.Alias, req.Type, err)
+		return "{}", runtime.NewError("Unable to check the version", internalErrorCode)
+	}
+	if exists {
+		return "{}", runtime.NewError(fmt.Sprintf("`%s` is a version of `%s`, it can't be an alias", req.Alias, req.Type), invalidArgumentCode)
+	}
+	if req.Version != nil {
+		err = checkAliasTarget(ctx, logger, db, cfg, req.Type, *req.Version)
+		if err != nil {
+			return "{}", err
+		}
+	}
+	snapshot, err := currentContentMetadata(ctx, logger, db)
+	if err != nil {
+		return "{}", err
+	}
+	var oldHash, newHash *string
+	oldVersion, ok := snapshot.alias(req.Type, req.Alias)
+	if ok {
+		oldHash = versionHash(cfg, req.Type, oldVersion)
+	}
+	version := ""
+	if req.Version != nil {
+		version = *req.Version
+		newHash = versionHash(cfg, req.Type, version)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to update alias: %v", err)
+		return "{}", runtime.NewError("Unable to update alias", internalErrorCode)
+	}
+	if req.Version != nil {
+		err = upsertAlias(ctx, tx, req.Type, req.Alias, version)
+	} else {
+		_, err = tx.ExecContext(ctx, `delete from downloader_content_aliases where type = $1 and alias = $2`, req.Type, req.Alias)
+	}
+	if err == nil {
+		err = writeAuditRecord(ctx, tx, auditRecord{
+			Actor: auditActor(ctx), Operation: "set_alias:" + req.Alias, Type: req.Type, Version: version,
+			OldHash: oldHash, NewHash: newHash, Reason: req.Reason,
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		_ = tx.Rollback()
+	}
+	if err != nil {
+		logger.Error("Failed to update alias: %v", err)
+		return "{}", runtime.NewError("Unable to update alias", internalErrorCode)
+	}
+	contentMetadata.invalidate()
+	return "{}", nil
+}
+
+/*
+Moves the live alias to the version and the previous live version to the previous alias in one transaction.
+Promotions of a type are serialized by an advisory lock, so concurrent ones can't lose the previous version.
+*/
+func RpcDownloaderPromote(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	err := checkServerToServer(ctx)
+	if err != nil {
+		return "{}", err
+	}
+	var req PromoteRequest
+	err = json.Unmarshal([]byte(payload), &req)
+	if err != nil {
+		logger.Info("Unable to deserialize request %v", err)
+		return "{}", runtime.NewError("Unable to deserialize request", invalidArgumentCode)
+	}
+	err = validateName("type", req.Type)
+	if err != nil {
+		return "{}", err
+	}
+	cfg := currentConfig()
+	err = checkAliasTarget(ctx, logger, db, cfg, req.Type, req.Version)
+	if err != nil {
+		return "{}", err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to promote version: %v", err)
+		return "{}", runtime.NewError("Unable to promote version", internalErrorCode)
+	}
+	resp, err := promote(ctx, tx, cfg, req)
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		_ = tx.Rollback()
+	}
+	var runtimeErr *runtime.Error
+	if errors.As(err, &runtimeErr) {
+		return "{}", err
+	}
+	if err != nil {
+		logger.Error("Failed to promote version: %v", err)
+		return "{}", runtime.NewError("Unable to promote version", internalErrorCode)
+	}
+	contentMetadata.invalidate()
+
+	respStr, err := json.Marshal(resp)
+	if err != nil {
+		return "{}", err
+	}
+	return string(respStr[:]), nil
+}
+
+func promote(ctx context.Context, tx *sql.Tx, cfg *moduleConfig, req PromoteRequest) (PromoteResponse, error) {
+	resp := PromoteResponse{Type: req.Type, Live: req.Version}
+	// A row lock isn't enough: there is nothing to lock before the first promotion of the type.
+	_, err := tx.ExecContext(ctx, `select pg_advisory_xact_lock(hashtext('downloader_promote'), hashtext($1))`, req.Type)
+	if err != nil {
+		return resp, err
+	}
+	var previous string
+	err = tx.QueryRowContext(ctx, `
+		select version from downloader_content_aliases where type = $1 and alias = $2
+	`, req.Type, liveAlias).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return resp, err
+	}
+	var oldHash *string
+	if err == nil {
+		if previous == req.Version {
+			return resp, runtime.NewError(fmt.Sprintf("Version `%s` of `%s` is already live", req.Version, req.Type), failedPreconditionCode)
+		}
+		resp.Previous = &previous
+		oldHash = versionHash(cfg, req.Type, previous)
+		err = upsertAlias(ctx, tx, req.Type, previousAlias, previous)
+		if err != nil {
+			return resp, err
+		}
+	}
+	err = upsertAlias(ctx, tx, req.Type, liveAlias, req.Version)
+	if err != nil {
+		return resp, err
+	}
+	err = writeAuditRecord(ctx, tx, auditRecord{
+		Actor: auditActor(ctx), Operation: "promote", Type: req.Type, Version: req.Version,
+		OldHash: oldHash, NewHash: versionHash(cfg, req.Type, req.Version), Reason: req.Reason,
+	})
+	return resp, err
+}
+
+func upsertAlias(ctx context.Context, tx *sql.Tx, typeName string, alias string, version string) error {
+	_, err := tx.ExecContext(ctx, `
+		insert into downloader_content_aliases(type, alias, version)
+		values($1, $2, $3)
+		on conflict(type, alias) do update
+		    set version = excluded.version,
+		        updated_at = now()
+	`, typeName, alias, version)
+	return err
+}
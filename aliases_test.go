@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func useContentAliases(t *testing.T, aliases map[contentKey]string) {
+	contentMetadata.store(&contentMetadataSnapshot{aliases: aliases, expiresAt: time.Now().AddDate(100, 0, 0)})
+	t.Cleanup(func() { contentMetadata.store(emptyContentMetadata()) })
+}
+
+func TestThatAliasIsResolvedToVersion(t *testing.T) {
+	useContentAliases(t, map[contentKey]string{{Type: "custom", Version: "live"}: "5.0.0"})
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "live", nil))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type": "custom", "version": "5.0.0", "alias": "live", "hash": "3181399843", "content": "{\"custom\": \"5.0.0\"}"}`, res)
+}
+
+func TestThatVersionTakesPrecedenceOverAliasWithSameName(t *testing.T) {
+	useContentAliases(t, map[contentKey]string{{Type: "core", Version: "1.0.0"}: "2.0.0"})
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("core", "1.0.0", nil))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type": "core", "version": "1.0.0", "hash": "2358080557", "content": "{\"core\": \"1.0.0\"}"}`, res)
+}
+
+func TestThatPromotionShiftsLiveVersionToPrevious(t *testing.T) {
+	db, dbMock := createDbMock()
+	newHash := "3181399843"
+	dbMock.ExpectBegin()
+	expectPromotionLock(dbMock, "custom")
+	dbMock.
+		ExpectQuery("select version from downloader_content_aliases where type = \\$1 and alias = \\$2").
+		WithArgs("custom", "live").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("4.0.0"))
+	dbMock.ExpectExec("insert into downloader_content_aliases").WithArgs("custom", "previous", "4.0.0").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("insert into downloader_content_aliases").WithArgs("custom", "live", "5.0.0").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.
+		ExpectExec("insert into downloader_audit_log").
+		WithArgs("server", "promote", "custom", "5.0.0", nil, &newHash, "release").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+
+	res, err := RpcDownloaderPromote(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "custom", "version": "5.0.0", "reason": "release"}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type": "custom", "live": "5.0.0", "previous": "4.0.0"}`, res)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatFirstPromotionHasNoPreviousVersion(t *testing.T) {
+	db, dbMock := createDbMock()
+	dbMock.ExpectBegin()
+	expectPromotionLock(dbMock, "custom")
+	dbMock.ExpectQuery("from downloader_content_aliases").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	dbMock.ExpectExec("insert into downloader_content_aliases").WithArgs("custom", "live", "5.0.0").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("insert into downloader_audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+
+	res, err := RpcDownloaderPromote(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom", "version": "5.0.0"}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type": "custom", "live": "5.0.0", "previous": null}`, res)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatLiveVersionCantBePromotedAgain(t *testing.T) {
+	db, dbMock := createDbMock()
+	dbMock.ExpectBegin()
+	expectPromotionLock(dbMock, "custom")
+	dbMock.ExpectQuery("from downloader_content_aliases").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("5.0.0"))
+	dbMock.ExpectRollback()
+
+	_, err := RpcDownloaderPromote(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom", "version": "5.0.0"}`)
+	assertErrorCode(t, err, failedPreconditionCode)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatMissingVersionCantBePromoted(t *testing.T) {
+	db, _ := createDbMock()
+
+	_, err := RpcDownloaderPromote(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom", "version": "9.0.0"}`)
+	assertErrorCode(t, err, notFoundCode)
+}
+
+func TestThatAliasIsStoredWithAuditRecord(t *testing.T) {
+	useContentAliases(t, map[contentKey]string{})
+	db, dbMock := createDbMock()
+	newHash := "3181399843"
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("insert into downloader_content_aliases").WithArgs("custom", "qa", "5.0.0").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.
+		ExpectExec("insert into downloader_audit_log").
+		WithArgs("server", "set_alias:qa", "custom", "5.0.0", nil, &newHash, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+
+	_, err := RpcDownloaderSetAlias(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom", "alias": "qa", "version": "5.0.0"}`)
+	assert.NoError(t, err)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatAliasAndVersionNamesDontClash(t *testing.T) {
+	useContentAliases(t, map[contentKey]string{{Type: "custom", Version: "live"}: "5.0.0"})
+	db, _ := createDbMock()
+
+	_, err := RpcDownloaderSetAlias(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom", "alias": "5.0.0", "version": "5.0.0"}`)
+	assertErrorCode(t, err, invalidArgumentCode)
+	_, err = RpcDownloaderPublish(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom", "version": "live", "content": "{}"}`)
+	assertErrorCode(t, err, invalidArgumentCode)
+}
+
+func TestThatPromotionAliasesCantBeSetDirectly(t *testing.T) {
+	db, dbMock := createDbMock()
+
+	for _, alias := range []string{liveAlias, previousAlias} {
+		_, err := RpcDownloaderSetAlias(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+			`{"type": "custom", "alias": "`+alias+`", "version": "5.0.0"}`)
+		assertErrorCode(t, err, invalidArgumentCode)
+	}
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatAliasesAreNotAvailableToUsers(t *testing.T) {
+	db, _ := createDbMock()
+
+	_, err := RpcDownloaderSetAlias(userContext("user-1"), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "core", "alias": "qa"}`)
+	assertErrorCode(t, err, permissionDeniedCode)
+	_, err = RpcDownloaderPromote(userContext("user-1"), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "core", "version": "1.0.0"}`)
+	assertErrorCode(t, err, permissionDeniedCode)
+}
+
+func expectPromotionLock(dbMock sqlmock.Sqlmock, typeName string) {
+	dbMock.ExpectExec("pg_advisory_xact_lock").WithArgs(typeName).WillReturnResult(sqlmock.NewResult(0, 0))
+}
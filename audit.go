@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultAuditLogPageSize = 100
+const maxAuditLogPageSize = 1000
+
+// An operation performed through an administrative RPC which changes the served content.
+type auditRecord struct {
+	Id        int64   `json:"id"`
+	CreatedAt int64   `json:"created_at"`
+	Actor     string  `json:"actor"`
+	Operation string  `json:"operation"`
+	Type      string  `json:"type"`
+	Version   string  `json:"version"`
+	OldHash   *string `json:"old_hash"`
+	NewHash   *string `json:"new_hash"`
+	Reason    string  `json:"reason"`
+}
+
+type AuditLogRequest struct {
+	Type      *string `json:"type,omitempty"`
+	Version   *string `json:"version,omitempty"`
+	Operation *string `json:"operation,omitempty"`
+	Actor     *string `json:"actor,omitempty"`
+	// Unix time in seconds, inclusive.
+	Since *int64 `json:"since,omitempty"`
+	// Unix time in seconds, exclusive.
+	Until  *int64  `json:"until,omitempty"`
+	Limit  *int    `json:"limit,omitempty"`
+	Cursor *string `json:"cursor,omitempty"`
+}
+
+type AuditLogResponse struct {
+	Records []auditRecord `json:"records"`
+	Cursor  *string       `json:"cursor"`
+}
+
+/*
+Administrative RPCs are called by CI pipelines and live-ops tools with the HTTP key, so the actor is usually
+the server itself. If an administrative operation is ever exposed to users, their ID is recorded instead.
+*/
+func auditActor(ctx context.Context) string {
+	if userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); userId != "" {
+		return "user:" + userId
+	}
+	return "server"
+}
+
+// The record is written in the same transaction as the change itself, so a change can't happen without a record.
+func writeAuditRecord(ctx context.Context, tx *sql.Tx, record auditRecord) error {
+	_, err := tx.ExecContext(ctx, `
+		insert into downloader_audit_log(actor, operation, type, version, old_hash, new_hash, reason)
+		values($1, $2, $3, $4, $5, $6, $7)
+	`, record.Actor, record.Operation, record.Type, record.Version, record.OldHash, record.NewHash, record.Reason)
+	return err
+}
+
+// Returns audit records from the newest to the oldest. The cursor is the ID of the last returned record.
+func RpcDownloaderAuditLog(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	err := checkServerToServer(ctx)
+	if err != nil {
+		return "{}", err
+	}
+	var req AuditLogRequest
+	if strings.TrimSpace(payload) != "" {
+		err = json.Unmarshal([]byte(payload), &req)
+		if err != nil {
+			logger.Info("Unable to deserialize request %v", err)
+			return "{}", runtime.NewError("Unable to deserialize request", invalidArgumentCode)
+		}
+	}
+	limit := defaultAuditLogPageSize
+	if req.Limit != nil {
+		if *req.Limit <= 0 || *req.Limit > maxAuditLogPageSize {
+			return "{}", runtime.NewError(fmt.Sprintf("`limit` must be between 1 and %d", maxAuditLogPageSize), invalidArgumentCode)
+		}
+		limit = *req.Limit
+	}
+
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if req.Type != nil {
+		addCondition("type = $%d", *req.Type)
+	}
+	if req.Version != nil {
+		addCondition("version = $%d", *req.Version)
+	}
+	if req.Operation != nil {
+		addCondition("operation = $%d", *req.Operation)
+	}
+	if req.Actor != nil {
+		addCondition("actor = $%d", *req.Actor)
+	}
+	if req.Since != nil {
+		addCondition("created_at >= $%d", time.Unix(*req.Since, 0).UTC())
+	}
+	if req.Until != nil {
+		addCondition("created_at < $%d", time.Unix(*req.Until, 0).UTC())
+	}
+	if req.Cursor != nil {
+		id, err := strconv.ParseInt(*req.Cursor, 10, 64)
+		if err != nil {
+			return "{}", runtime.NewError("`cursor` is invalid", invalidArgumentCode)
+		}
+		addCondition("id < $%d", id)
+	}
+	query := `select id, created_at, actor, operation, type, version, old_hash, new_hash, reason from downloader_audit_log`
+	if len(conditions) > 0 {
+		query += " where " + strings.Join(conditions, " and ")
+	}
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" order by id desc limit $%d", len(args))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.Error("Failed to read audit log: %v", err)
+		return "{}", runtime.NewError("Unable to read audit log", internalErrorCode)
+	}
+	defer rows.Close()
+
+	resp := AuditLogResponse{Records: []auditRecord{}}
+	for rows.Next() {
+		var record auditRecord
+		var createdAt time.Time
+		err = rows.Scan(&record.Id, &createdAt, &record.Actor, &record.Operation, &record.Type, &record.Version,
+			&record.OldHash, &record.NewHash, &record.Reason)
+		if err != nil {
+			logger.Error("Failed to read audit log: %v", err)
+			return "{}", runtime.NewError("Unable to read audit log", internalErrorCode)
+		}
+		record.CreatedAt = createdAt.Unix()
+		resp.Records = append(resp.Records, record)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Failed to read audit log: %v", err)
+		return "{}", runtime.NewError("Unable to read audit log", internalErrorCode)
+	}
+	if len(resp.Records) > limit {
+		resp.Records = resp.Records[:limit]
+		cursor := strconv.FormatInt(resp.Records[limit-1].Id, 10)
+		resp.Cursor = &cursor
+	}
+
+	respStr, err := json.Marshal(resp)
+	if err != nil {
+		return "{}", err
+	}
+	return string(respStr[:]), nil
+}
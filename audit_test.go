@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var auditLogColumns = []string{"id", "created_at", "actor", "operation", "type", "version", "old_hash", "new_hash", "reason"}
+
+func TestThatAuditLogIsFilteredAndPaginated(t *testing.T) {
+	db, dbMock := createDbMock()
+	createdAt := time.Unix(1700000000, 0)
+	dbMock.
+		ExpectQuery(`from downloader_audit_log where type = \$1 and created_at >= \$2 and id < \$3 order by id desc limit \$4`).
+		WithArgs("core", time.Unix(1600000000, 0).UTC(), int64(10), 3).
+		WillReturnRows(sqlmock.NewRows(auditLogColumns).
+			AddRow(9, createdAt, "server", "publish", "core", "1.2.0", nil, "1", "release").
+			AddRow(8, createdAt, "server", "publish", "core", "1.1.0", nil, "2", "").
+			AddRow(7, createdAt, "server", "publish", "core", "1.0.0", nil, "3", ""))
+
+	res, err := RpcDownloaderAuditLog(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "core", "since": 1600000000, "cursor": "10", "limit": 2}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"records": [
+			{"id": 9, "created_at": 1700000000, "actor": "server", "operation": "publish", "type": "core", "version": "1.2.0", "old_hash": null, "new_hash": "1", "reason": "release"},
+			{"id": 8, "created_at": 1700000000, "actor": "server", "operation": "publish", "type": "core", "version": "1.1.0", "old_hash": null, "new_hash": "2", "reason": ""}
+		],
+		"cursor": "8"
+	}`, res)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatAuditLogIsNotAvailableToUsers(t *testing.T) {
+	db, _ := createDbMock()
+
+	res, err := RpcDownloaderAuditLog(userContext("user-1"), buildLoggerMock(), db, buildNakamaModuleMock(t), "")
+	assertErrorCode(t, err, permissionDeniedCode)
+	assert.Equal(t, "{}", res)
+}
+
+func TestThatAuditRecordIsWrittenInTransaction(t *testing.T) {
+	db, dbMock := createDbMock()
+	newHash := "42"
+	dbMock.ExpectBegin()
+	dbMock.
+		ExpectExec("insert into downloader_audit_log").
+		WithArgs("user:admin", "publish", "core", "1.0.0", nil, &newHash, "initial").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	err = writeAuditRecord(context.Background(), tx, auditRecord{
+		Actor: auditActor(userContext("admin")), Operation: "publish", Type: "core", Version: "1.0.0", NewHash: &newHash, Reason: "initial",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
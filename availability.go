@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"time"
+)
+
+type AvailabilityRequest struct {
+	Type    string `json:"type"`
+	Version string `json:"version"`
+	// Unix time in seconds, the version is not served before it.
+	AvailableFrom *int64 `json:"available_from,omitempty"`
+	// Unix time in seconds, the version is not served since it.
+	AvailableUntil *int64 `json:"available_until,omitempty"`
+	// A cron expression for recurring content, every window starts at the scheduled time and lasts `duration_seconds`.
+	Schedule        *string `json:"schedule,omitempty"`
+	DurationSeconds *int64  `json:"duration_seconds,omitempty"`
+	Reason          string  `json:"reason"`
+}
+
+/*
+A version is available if the current time is inside its publication window and, for recurring content,
+inside one of the scheduled windows. The latter is checked by finding the first scheduled time after
+`now - duration`: if it's not in the future, the current window is still open.
+*/
+func isVersionAvailable(nk runtime.NakamaModule, metadata versionMetadata, now time.Time) (bool, error) {
+	if metadata.AvailableFrom != nil && now.Before(*metadata.AvailableFrom) {
+		return false, nil
+	}
+	if metadata.AvailableUntil != nil && !now.Before(*metadata.AvailableUntil) {
+		return false, nil
+	}
+	if metadata.Schedule == "" {
+		return true, nil
+	}
+	windowStart, err := nk.CronNext(metadata.Schedule, now.Add(-metadata.ScheduleDuration).Unix())
+	if err != nil {
+		return false, err
+	}
+	return windowStart <= now.Unix(), nil
+}
+
+func currentContentMetadata(ctx context.Context, logger runtime.Logger, db *sql.DB) (*contentMetadataSnapshot, error) {
+	snapshot, err := contentMetadata.get(ctx, db)
+	if err != nil {
+		if snapshot == nil {
+			logger.Error("Unable to load content metadata: %v", err)
+			return nil, runtime.NewError("Unable to check availability", internalErrorCode)
+		}
+		logger.Warn("Unable to refresh content metadata, the previous one is used: %v", err)
+	}
+	return snapshot, nil
+}
+
+func versionMetadataFor(ctx context.Context, logger runtime.Logger, db *sql.DB, typeName string, version string) (versionMetadata, error) {
+	snapshot, err := currentContentMetadata(ctx, logger, db)
+	if err != nil {
+		return versionMetadata{}, err
+	}
+	return snapshot.version(typeName, version), nil
+}
+
+func checkVersionAvailable(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, typeName string, version string) (bool, error) {
+	metadata, err := versionMetadataFor(ctx, logger, db, typeName, version)
+	if err != nil {
+		return false, err
+	}
+	if metadata.RemovedAt != nil {
+		return false, nil
+	}
+	available, err := isVersionAvailable(nk, metadata, time.Now())
+	if err != nil {
+		logger.Error("Unable to check schedule of %s/%s: %v", typeName, version, err)
+		return false, runtime.NewError("Unable to check availability", internalErrorCode)
+	}
+	return available, nil
+}
+
+// Sets the publication window and the schedule of a version. Omitted fields are cleared.
+func RpcDownloaderSetAvailability(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	err := checkServerToServer(ctx)
+	if err != nil {
+		return "{}", err
+	}
+	var req AvailabilityRequest
+	err = json.Unmarshal([]byte(payload), &req)
+	if err != nil {
+		logger.Info("Unable to deserialize request %v", err)
+		return "{}", runtime.NewError("Unable to deserialize request", invalidArgumentCode)
+	}
+	err = validateRequest(DownloaderRequest{Type: req.Type, Version: req.Version})
+	if err != nil {
+		return "{}", err
+	}
+
+	var availableFrom, availableUntil *time.Time
+	if req.AvailableFrom != nil {
+		t := time.Unix(*req.AvailableFrom, 0).UTC()
+		availableFrom = &t
+	}
+	if req.AvailableUntil != nil {
+		t := time.Unix(*req.AvailableUntil, 0).UTC()
+		availableUntil = &t
+	}
+	if availableFrom != nil && availableUntil != nil && !availableFrom.Before(*availableUntil) {
+		return "{}", runtime.NewError("`available_from` must be before `available_until`", invalidArgumentCode)
+	}
+	var scheduleDuration *int64
+	if req.Schedule != nil {
+		if _, err = nk.CronNext(*req.Schedule, time.Now().Unix()); err != nil {
+			return "{}", runtime.NewError("`schedule` must be a valid cron expression", invalidArgumentCode)
+		}
+		if req.DurationSeconds == nil || *req.DurationSeconds <= 0 {
+			return "{}", runtime.NewError("`duration_seconds` must be positive for a schedule", invalidArgumentCode)
+		}
+		scheduleDuration = req.DurationSeconds
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to update availability: %v", err)
+		return "{}", runtime.NewError("Unable to update availability", internalErrorCode)
+	}
+	_, err = tx.ExecContext(ctx, `
+		insert into downloader_content_versions(type, version, available_from, available_until, schedule, schedule_duration)
+		values($1, $2, $3, $4, $5, $6)
+		on conflict(type, version) do update
+		    set available_from = excluded.available_from,
+		        available_until = excluded.available_until,
+		        schedule = excluded.schedule,
+		        schedule_duration = excluded.schedule_duration,
+		        updated_at = now()
+	`, req.Type, req.Version, availableFrom, availableUntil, req.Schedule, scheduleDuration)
+	if err == nil {
+		err = writeAuditRecord(ctx, tx, auditRecord{
+			Actor: auditActor(ctx), Operation: "set_availability", Type: req.Type, Version: req.Version, Reason: req.Reason,
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		_ = tx.Rollback()
+	}
+	if err != nil {
+		logger.Error("Failed to update availability: %v", err)
+		return "{}", runtime.NewError("Unable to update availability", internalErrorCode)
+	}
+	contentMetadata.invalidate()
+	if err = syncCatalogType(ctx, logger, db, nk, currentConfig(), req.Type); err != nil {
+		logger.Warn("Failed to update the content catalog: %v", err)
+	}
+	return "{}", nil
+}
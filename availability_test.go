@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+var contentVersionsColumns = []string{
+	"type", "version", "available_from", "available_until", "schedule", "schedule_duration", "deprecated", "replacement", "removed_at",
+}
+
+func TestThatVersionIsNotServedBeforeItsPublication(t *testing.T) {
+	availableFrom := time.Now().Add(time.Hour)
+	useContentMetadata(t, map[contentKey]versionMetadata{{Type: "custom", Version: "5.0.0"}: {AvailableFrom: &availableFrom}})
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "5.0.0", nil))
+	assertErrorCode(t, err, notFoundCode)
+	assert.Equal(t, "{}", res)
+}
+
+func TestThatVersionIsNotServedAfterItsExpiry(t *testing.T) {
+	availableUntil := time.Now().Add(-time.Second)
+	useContentMetadata(t, map[contentKey]versionMetadata{{Type: "custom", Version: "5.0.0"}: {AvailableUntil: &availableUntil}})
+	db, _ := createDbMock()
+
+	_, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "5.0.0", nil))
+	assertErrorCode(t, err, notFoundCode)
+	res, err := RpcFileList(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom"}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"types": [{"type": "custom", "versions": []}]}`, res)
+}
+
+func TestThatRecurringVersionIsServedOnlyInsideScheduledWindow(t *testing.T) {
+	useContentMetadata(t, map[contentKey]versionMetadata{
+		{Type: "custom", Version: "5.0.0"}: {Schedule: "0 0 * * 6", ScheduleDuration: 48 * time.Hour},
+	})
+	db, _ := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+	mockNakamaModule.On("CronNext", "0 0 * * 6", mock.Anything).Return(time.Now().Add(-time.Hour).Unix(), nil).Once()
+	mockNakamaModule.On("CronNext", "0 0 * * 6", mock.Anything).Return(time.Now().Add(time.Hour).Unix(), nil).Once()
+
+	_, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, mockNakamaModule, buildPayload("custom", "5.0.0", nil))
+	assert.NoError(t, err)
+	_, err = RpcFileDownloader(context.Background(), buildLoggerMock(), db, mockNakamaModule, buildPayload("custom", "5.0.0", nil))
+	assertErrorCode(t, err, notFoundCode)
+}
+
+func TestThatAvailabilityIsStoredWithAuditRecord(t *testing.T) {
+	db, dbMock := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+	mockNakamaModule.On("CronNext", "0 0 * * 6", mock.Anything).Return(int64(0), nil).Once()
+	dbMock.ExpectBegin()
+	dbMock.
+		ExpectExec("insert into downloader_content_versions").
+		WithArgs("events", "halloween", time.Unix(1000, 0).UTC(), nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.
+		ExpectExec("insert into downloader_audit_log").
+		WithArgs("server", "set_availability", "events", "halloween", nil, nil, "weekly event").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+	payload := `{"type": "events", "version": "halloween", "available_from": 1000, "schedule": "0 0 * * 6", "duration_seconds": 3600, "reason": "weekly event"}`
+
+	res, err := RpcDownloaderSetAvailability(context.Background(), buildLoggerMock(), db, mockNakamaModule, payload)
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", res)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatScheduleRequiresDuration(t *testing.T) {
+	db, _ := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+	mockNakamaModule.On("CronNext", "0 0 * * 6", mock.Anything).Return(int64(0), nil).Once()
+
+	_, err := RpcDownloaderSetAvailability(context.Background(), buildLoggerMock(), db, mockNakamaModule,
+		`{"type": "events", "version": "halloween", "schedule": "0 0 * * 6"}`)
+	assert.EqualError(t, err, "`duration_seconds` must be positive for a schedule")
+}
+
+func TestThatMetadataCacheKeepsPreviousSnapshotIfDatabaseFails(t *testing.T) {
+	db, dbMock := createDbMock()
+	cache := &contentMetadataCache{}
+	dbMock.
+		ExpectQuery("from downloader_content_versions").
+		WillReturnRows(sqlmock.NewRows(contentVersionsColumns).
+			AddRow("events", "halloween", nil, time.Unix(1000, 0), "0 0 * * 6", 3600, false, nil, nil))
+	dbMock.
+		ExpectQuery("from downloader_content_aliases").
+		WillReturnRows(sqlmock.NewRows([]string{"type", "alias", "version"}).AddRow("events", "live", "halloween"))
+	dbMock.ExpectQuery("from downloader_content_versions").WillReturnError(assert.AnError)
+
+	snapshot, err := cache.get(context.Background(), db)
+	assert.NoError(t, err)
+	metadata := snapshot.version("events", "halloween")
+	assert.Equal(t, time.Unix(1000, 0), *metadata.AvailableUntil)
+	assert.Equal(t, time.Hour, metadata.ScheduleDuration)
+
+	cache.invalidate()
+	stale, err := cache.get(context.Background(), db)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Same(t, snapshot, stale)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"os"
+)
+
+/*
+The catalog of content is mirrored to storage objects, so it can be browsed in the Storage section of the Nakama
+console. Every type is an object owned by the system user with the type as the key. Objects can't be read or
+written by clients, and the mirror is never read by the module: files and the database remain the source of truth.
+*/
+const catalogCollection = "downloader_catalog"
+
+const catalogListLimit = 100
+
+const (
+	catalogStatusAvailable   = "available"
+	catalogStatusScheduled   = "scheduled"
+	catalogStatusDeprecated  = "deprecated"
+	catalogStatusQuarantined = "quarantined"
+	catalogStatusUnreadable  = "unreadable"
+)
+
+type CatalogType struct {
+	Type     string         `json:"type"`
+	Versions []CatalogEntry `json:"versions"`
+}
+
+type CatalogEntry struct {
+	Version string `json:"version"`
+	// The hash and the size of the plain content, the same as in responses of the downloader.
+	Hash   string `json:"hash,omitempty"`
+	Size   int64  `json:"size"`
+	Status string `json:"status"`
+	// The name of the root which serves the version, see contentRoot.
+	Source string `json:"source"`
+}
+
+/*
+Rewrites the mirror of every type and deletes objects of types which no longer exist. The status of scheduled
+versions isn't updated when their windows open or close, it only tells that the version has a schedule.
+*/
+func syncCatalog(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, cfg *moduleConfig) error {
+	types, err := listAllContentTypes(cfg)
+	if err != nil {
+		return err
+	}
+	current := make(map[string]bool, len(types))
+	for _, typeName := range types {
+		current[typeName] = true
+		err = syncCatalogType(ctx, logger, db, nk, cfg, typeName)
+		if err != nil {
+			return err
+		}
+	}
+
+	var stale []*runtime.StorageDelete
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", catalogCollection, catalogListLimit, cursor)
+		if err != nil {
+			return err
+		}
+		for _, object := range objects {
+			if !current[object.Key] {
+				stale = append(stale, &runtime.StorageDelete{Collection: catalogCollection, Key: object.Key})
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	return nk.StorageDelete(ctx, stale)
+}
+
+// Updates the mirror of one type, the object is deleted if the type has no versions left.
+func syncCatalogType(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, cfg *moduleConfig, typeName string) error {
+	entries, err := buildCatalogEntries(ctx, logger, db, cfg, typeName)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nk.StorageDelete(ctx, []*runtime.StorageDelete{{Collection: catalogCollection, Key: typeName}})
+	}
+	value, err := json.Marshal(CatalogType{Type: typeName, Versions: entries})
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      catalogCollection,
+		Key:             typeName,
+		Value:           string(value),
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}})
+	return err
+}
+
+func buildCatalogEntries(ctx context.Context, logger runtime.Logger, db *sql.DB, cfg *moduleConfig, typeName string) ([]CatalogEntry, error) {
+	versions, sources, err := listAllContentVersions(cfg, typeName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	snapshot, err := currentContentMetadata(ctx, logger, db)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]CatalogEntry, 0, len(versions))
+	for _, version := range versions {
+		metadata := snapshot.version(typeName, version)
+		if metadata.RemovedAt != nil {
+			continue
+		}
+		entry := CatalogEntry{Version: version, Source: sources[version], Status: catalogStatus(typeName, version, metadata)}
+		content, err := readCatalogContent(cfg, typeName, version)
+		if err != nil {
+			logger.Warn("Unable to read version %s of %s for the catalog: %v", version, typeName, err)
+			entry.Status = catalogStatusUnreadable
+		} else {
+			entry.Hash = contentHash(content)
+			entry.Size = int64(len(content))
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func catalogStatus(typeName string, version string, metadata versionMetadata) string {
+	switch {
+	case quarantinedContent.contains(typeName, version):
+		return catalogStatusQuarantined
+	case metadata.Deprecated:
+		return catalogStatusDeprecated
+	case metadata.AvailableFrom != nil || metadata.AvailableUntil != nil || metadata.Schedule != "":
+		return catalogStatusScheduled
+	default:
+		return catalogStatusAvailable
+	}
+}
+
+func readCatalogContent(cfg *moduleConfig, typeName string, version string) ([]byte, error) {
+	filePath, err := buildFilePath(cfg, typeName, version)
+	if err != nil {
+		return nil, err
+	}
+	resolvedPath, err := resolveFilePath(cfg, filePath)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readFileWithLimit(resolvedPath, maxFileSizeFor(cfg.MaxFileSizes, typeName))
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := encryptionKeyFor(cfg.EncryptionKeys, typeName); ok {
+		return decryptContent(key, typeName, content)
+	}
+	return content, nil
+}
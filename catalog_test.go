@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	mocks "pendyurinandrey.com/nakama-downloader-module/mocks/github.com/heroiclabs/nakama-common/runtime"
+	"testing"
+	"time"
+)
+
+func captureCatalogWrites(mockNakamaModule *mocks.NakamaModuleMock) map[string]CatalogType {
+	catalog := make(map[string]CatalogType)
+	mockNakamaModule.On("StorageWrite", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		for _, write := range args.Get(1).([]*runtime.StorageWrite) {
+			var catalogType CatalogType
+			if err := json.Unmarshal([]byte(write.Value), &catalogType); err != nil {
+				panic(err)
+			}
+			if write.Collection != catalogCollection || write.UserID != "" ||
+				write.PermissionRead != runtime.STORAGE_PERMISSION_NO_READ || write.PermissionWrite != runtime.STORAGE_PERMISSION_NO_WRITE {
+				panic("catalog objects must be read-only system objects")
+			}
+			catalog[write.Key] = catalogType
+		}
+	}).Return(nil, nil)
+	return catalog
+}
+
+func TestThatCatalogTypeIsMirroredToStorage(t *testing.T) {
+	root := t.TempDir()
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	writeContentFile(t, root, "custom", "5.0.0", []byte(`{"custom": "5.0.0"}`))
+	writeContentFile(t, root, "custom", "6.0.0", []byte(`{}`))
+	writeContentFile(t, root, "custom", "7.0.0", []byte(`{}`))
+	useContentMetadata(t, map[contentKey]versionMetadata{
+		{Type: "custom", Version: "6.0.0"}: {Deprecated: true, Replacement: "5.0.0"},
+		{Type: "custom", Version: "7.0.0"}: {Schedule: "0 0 * * 6"},
+	})
+	db, _ := createDbMock()
+	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	catalog := captureCatalogWrites(mockNakamaModule)
+
+	err := syncCatalogType(context.Background(), buildLoggerMock(), db, mockNakamaModule, currentConfig(), "custom")
+	assert.NoError(t, err)
+	assert.Equal(t, CatalogType{Type: "custom", Versions: []CatalogEntry{
+		{Version: "5.0.0", Hash: "3181399843", Size: 19, Status: catalogStatusAvailable, Source: defaultRootName},
+		{Version: "6.0.0", Hash: contentHash([]byte(`{}`)), Size: 2, Status: catalogStatusDeprecated, Source: defaultRootName},
+		{Version: "7.0.0", Hash: contentHash([]byte(`{}`)), Size: 2, Status: catalogStatusScheduled, Source: defaultRootName},
+	}}, catalog["custom"])
+}
+
+func TestThatCatalogOfTypeWithoutVersionsIsDeleted(t *testing.T) {
+	removedAt := time.Now()
+	useContentMetadata(t, map[contentKey]versionMetadata{{Type: "custom", Version: "5.0.0"}: {RemovedAt: &removedAt}})
+	db, _ := createDbMock()
+	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule.On("StorageDelete", mock.Anything, []*runtime.StorageDelete{{Collection: catalogCollection, Key: "custom"}}).Return(nil).Once()
+
+	err := syncCatalogType(context.Background(), buildLoggerMock(), db, mockNakamaModule, currentConfig(), "custom")
+	assert.NoError(t, err)
+}
+
+func TestThatCatalogOfRemovedTypesIsDeleted(t *testing.T) {
+	db, _ := createDbMock()
+	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	catalog := captureCatalogWrites(mockNakamaModule)
+	mockNakamaModule.On("StorageList", mock.Anything, "", "", catalogCollection, catalogListLimit, "").
+		Return([]*api.StorageObject{{Collection: catalogCollection, Key: "core"}}, "next", nil).Once()
+	mockNakamaModule.On("StorageList", mock.Anything, "", "", catalogCollection, catalogListLimit, "next").
+		Return([]*api.StorageObject{{Collection: catalogCollection, Key: "obsolete"}}, "", nil).Once()
+	mockNakamaModule.On("StorageDelete", mock.Anything, []*runtime.StorageDelete{{Collection: catalogCollection, Key: "obsolete"}}).Return(nil).Once()
+
+	err := syncCatalog(context.Background(), buildLoggerMock(), db, mockNakamaModule, currentConfig())
+	assert.NoError(t, err)
+	assert.Len(t, catalog, 2)
+	assert.Equal(t, "2358080557", catalog["core"].Versions[0].Hash)
+}
+
+func TestThatValidationUpdatesCatalog(t *testing.T) {
+	useContentRootWithSchema(t)
+	db, _ := createDbMock()
+	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	catalog := captureCatalogWrites(mockNakamaModule)
+	mockNakamaModule.On("StorageList", mock.Anything, "", "", catalogCollection, catalogListLimit, "").Return(nil, "", nil).Once()
+	mockNakamaModule.On("MetricsGaugeSet", quarantinedVersionsMetricName, map[string]string{}, float64(1)).Return().Once()
+
+	_, err := RpcDownloaderValidateContent(context.Background(), buildLoggerMock(), db, mockNakamaModule, "")
+	assert.NoError(t, err)
+	assert.Equal(t, catalogStatusAvailable, catalog["custom"].Versions[0].Status)
+	assert.Equal(t, catalogStatusQuarantined, catalog["custom"].Versions[1].Status)
+}
+
+func TestThatAvailabilityUpdatesCatalog(t *testing.T) {
+	db, dbMock := createDbMock()
+	useContentMetadata(t, map[contentKey]versionMetadata{})
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("insert into downloader_content_versions").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("insert into downloader_audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+	dbMock.
+		ExpectQuery("from downloader_content_versions").
+		WillReturnRows(sqlmock.NewRows(contentVersionsColumns).
+			AddRow("custom", "5.0.0", time.Unix(1000, 0), nil, nil, nil, false, nil, nil))
+	dbMock.ExpectQuery("from downloader_content_aliases").WillReturnRows(sqlmock.NewRows([]string{"type", "alias", "version"}))
+	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	catalog := captureCatalogWrites(mockNakamaModule)
+
+	_, err := RpcDownloaderSetAvailability(context.Background(), buildLoggerMock(), db, mockNakamaModule,
+		`{"type": "custom", "version": "5.0.0", "available_from": 1000}`)
+	assert.NoError(t, err)
+	assert.Equal(t, catalogStatusScheduled, catalog["custom"].Versions[0].Status)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
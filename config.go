@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+type ReloadConfigRequest struct {
+	// Settings which override the runtime env and the env vars of the process until the next reload.
+	Settings map[string]string `json:"settings"`
+	Reason   string            `json:"reason"`
+}
+
+/*
+The configuration is loaded once in InitModule. Values are taken from the `runtime.env` section of Nakama's
+config (exposed as RUNTIME_CTX_ENV), process env vars are used as a fallback, e.g. for the Docker env file.
+If the `config_file` setting points to a YAML file, the file is applied first and settings from the env
+replace the same settings from the file. Every value is validated on load, so a mistake fails the module load
+instead of every request.
+*/
+type moduleConfig struct {
+	DefaultType string
+	// Optional, it's used only for DefaultType, see defaultVersionFor.
+	DefaultVersion  string
+	DefaultVersions map[string]string
+	FilePath        string
+	// Ordered by priority, the root from FilePath is always included, see buildContentRoots.
+	Roots []contentRoot
+	// Extensions of content files, `.json` by default.
+	Extensions map[string]string
+	// Nil means the latest schema version.
+	SchemaVersion   *int
+	AccessRules     map[string]accessRule
+	RateLimits      map[string]rateLimit
+	MaxFileSizes    map[string]int64
+	MaxResponseSize int64
+	// Download tokens can't be issued or checked without a secret.
+	DownloadTokenSecret string
+	Entitlements        map[string]entitlement
+	EncryptionKeys      map[string][]byte
+	EndToEndEncrypted   map[string]bool
+	ContentSchemas      map[string]interface{}
+}
+
+/*
+The configuration is immutable once loaded: a reload builds a new one and swaps the pointer,
+so concurrent requests never see a partially updated configuration. Every RPC loads it once and passes it down,
+otherwise a reload in the middle of a request could mix settings of two configurations.
+*/
+var activeConfig atomic.Pointer[moduleConfig]
+
+func currentConfig() *moduleConfig {
+	return activeConfig.Load()
+}
+
+type configValue struct {
+	key   string
+	parse func(value string) error
+}
+
+func loadConfig(env map[string]string) (*moduleConfig, error) {
+	cfg := &moduleConfig{
+		DefaultVersions:   map[string]string{},
+		Extensions:        map[string]string{},
+		AccessRules:       map[string]accessRule{},
+		RateLimits:        map[string]rateLimit{},
+		MaxFileSizes:      map[string]int64{},
+		MaxResponseSize:   defaultMaxResponseSize,
+		Entitlements:      map[string]entitlement{},
+		EncryptionKeys:    map[string][]byte{},
+		EndToEndEncrypted: map[string]bool{},
+		ContentSchemas:    map[string]interface{}{},
+	}
+	values := []configValue{
+		{defaultTypeEnvVarName, func(value string) error {
+			cfg.DefaultType = value
+			return validateName("type", value)
+		}},
+		{defaultVersionEnvVarName, func(value string) error {
+			cfg.DefaultVersion = value
+			return validateName("version", value)
+		}},
+		{defaultVersionsEnvVarName, func(value string) (err error) {
+			cfg.DefaultVersions, err = parseDefaultVersions(value)
+			return err
+		}},
+		{defaultFilePathEnvVarName, func(value string) error {
+			cfg.FilePath = value
+			if value == "" {
+				return fmt.Errorf("must not be empty")
+			}
+			return nil
+		}},
+		{contentRootsEnvVarName, func(value string) (err error) {
+			cfg.Roots, err = parseContentRoots(value)
+			return err
+		}},
+		{schemaVersionEnvVarName, func(value string) error {
+			version, err := strconv.Atoi(value)
+			if err != nil || version < 0 || version > latestSchemaVersion() {
+				return fmt.Errorf("must be a number between 0 and %d", latestSchemaVersion())
+			}
+			cfg.SchemaVersion = &version
+			return nil
+		}},
+		{accessControlEnvVarName, func(value string) (err error) {
+			cfg.AccessRules, err = parseAccessRules(value)
+			return err
+		}},
+		{rateLimitsEnvVarName, func(value string) (err error) {
+			cfg.RateLimits, err = parseRateLimits(value)
+			return err
+		}},
+		{maxFileSizesEnvVarName, func(value string) (err error) {
+			cfg.MaxFileSizes, err = parseMaxFileSizes(value)
+			return err
+		}},
+		{maxResponseSizeEnvVarName, func(value string) error {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size <= 0 {
+				return fmt.Errorf("must be a positive number")
+			}
+			cfg.MaxResponseSize = size
+			return nil
+		}},
+		{downloadTokenSecretEnvVarName, func(value string) error {
+			cfg.DownloadTokenSecret = value
+			return nil
+		}},
+		{entitlementsEnvVarName, func(value string) (err error) {
+			cfg.Entitlements, err = parseEntitlements(value)
+			return err
+		}},
+		{encryptionKeysEnvVarName, func(value string) (err error) {
+			cfg.EncryptionKeys, err = parseEncryptionKeys(value)
+			return err
+		}},
+		{endToEndEncryptionEnvVarName, func(value string) (err error) {
+			cfg.EndToEndEncrypted, err = parseEndToEndEncryptedTypes(value)
+			return err
+		}},
+		{contentSchemasEnvVarName, func(value string) (err error) {
+			cfg.ContentSchemas, err = parseContentSchemas(value)
+			return err
+		}},
+	}
+
+	lookup := func(key string) (string, bool) {
+		if value, ok := env[key]; ok {
+			return value, true
+		}
+		return os.LookupEnv(key)
+	}
+	if path, ok := lookup(configFileEnvVarName); ok {
+		err := applyConfigFile(cfg, path)
+		if err != nil {
+			return nil, fmt.Errorf("wrong config file `%s`: %w", path, err)
+		}
+	}
+	for _, v := range values {
+		value, ok := lookup(v.key)
+		if !ok {
+			continue
+		}
+		err := v.parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("wrong `%s`: %w", v.key, err)
+		}
+	}
+
+	if cfg.DefaultType == "" {
+		return nil, fmt.Errorf("`%s` is not set", defaultTypeEnvVarName)
+	}
+	if cfg.FilePath == "" {
+		return nil, fmt.Errorf("`%s` is not set", defaultFilePathEnvVarName)
+	}
+	roots, err := buildContentRoots(cfg.Roots, cfg.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("wrong `%s`: %w", contentRootsEnvVarName, err)
+	}
+	cfg.Roots = roots
+	return cfg, nil
+}
+
+func parseDefaultVersions(value string) (map[string]string, error) {
+	var versions map[string]string
+	err := json.Unmarshal([]byte(value), &versions)
+	if err != nil {
+		return nil, err
+	}
+	for typeName, version := range versions {
+		if typeName != anyTypeKey {
+			if err = validateName("type", typeName); err != nil {
+				return nil, err
+			}
+		}
+		if err = validateName("version", version); err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+/*
+Builds the configuration from scratch and swaps it, so settings omitted from the request revert to their values
+from the env. Only the node which handles the call is reloaded, in a cluster it has to be called on every node.
+Content is validated again, because the root folder or the schemas may have changed.
+*/
+func RpcDownloaderReloadConfig(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	err := checkServerToServer(ctx)
+	if err != nil {
+		return "{}", err
+	}
+	var req ReloadConfigRequest
+	if strings.TrimSpace(payload) != "" {
+		err = json.Unmarshal([]byte(payload), &req)
+		if err != nil {
+			logger.Info("Unable to deserialize request %v", err)
+			return "{}", runtime.NewError("Unable to deserialize request", invalidArgumentCode)
+		}
+	}
+	if _, ok := req.Settings[schemaVersionEnvVarName]; ok {
+		return "{}", runtime.NewError(fmt.Sprintf("`%s` is applied only on startup", schemaVersionEnvVarName), invalidArgumentCode)
+	}
+
+	runtimeEnv, _ := ctx.Value(runtime.RUNTIME_CTX_ENV).(map[string]string)
+	env := make(map[string]string, len(runtimeEnv)+len(req.Settings))
+	for key, value := range runtimeEnv {
+		env[key] = value
+	}
+	for key, value := range req.Settings {
+		env[key] = value
+	}
+	cfg, err := loadConfig(env)
+	if err != nil {
+		return "{}", runtime.NewError(fmt.Sprintf("Configuration is not reloaded: %v", err), invalidArgumentCode)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err == nil {
+		err = writeAuditRecord(ctx, tx, auditRecord{Actor: auditActor(ctx), Operation: "reload_config", Reason: req.Reason})
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			_ = tx.Rollback()
+		}
+	}
+	if err != nil {
+		logger.Error("Failed to reload configuration: %v", err)
+		return "{}", runtime.NewError("Unable to reload configuration", internalErrorCode)
+	}
+	activeConfig.Store(cfg)
+	logger.Info("Configuration is reloaded")
+
+	_, err = sweepContent(logger, nk, cfg)
+	if err != nil {
+		logger.Warn("Unable to validate content: %v", err)
+	}
+	err = createPopularContentLeaderboards(ctx, logger, nk, cfg)
+	if err != nil {
+		logger.Warn("Failed to create popular content leaderboards: %v", err)
+	}
+	err = syncCatalog(ctx, logger, db, nk, cfg)
+	if err != nil {
+		logger.Warn("Failed to update the content catalog: %v", err)
+	}
+	return "{}", nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"sync"
+	"testing"
+)
+
+func TestThatRuntimeEnvTakesPrecedenceOverProcessEnv(t *testing.T) {
+	t.Setenv(defaultTypeEnvVarName, "custom")
+	t.Setenv(maxResponseSizeEnvVarName, "64")
+
+	cfg, err := loadConfig(testEnv)
+	assert.NoError(t, err)
+	assert.Equal(t, "core", cfg.DefaultType)
+	assert.Equal(t, int64(64), cfg.MaxResponseSize)
+}
+
+func TestThatOptionalValuesHaveDefaults(t *testing.T) {
+	cfg, err := loadConfig(testEnv)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultMaxResponseSize, cfg.MaxResponseSize)
+	assert.Nil(t, cfg.SchemaVersion)
+	assert.Empty(t, cfg.AccessRules)
+	assert.Equal(t, defaultMaxFileSize, maxFileSizeFor(cfg.MaxFileSizes, "core"))
+}
+
+func TestThatMissingRequiredValueIsReported(t *testing.T) {
+	_, err := loadConfig(map[string]string{defaultTypeEnvVarName: "core"})
+	assert.EqualError(t, err, "`default_file_path` is not set")
+}
+
+func TestThatWrongValuesAreReportedWithTheirKeys(t *testing.T) {
+	for key, value := range map[string]string{
+		defaultTypeEnvVarName:        "../core",
+		schemaVersionEnvVarName:      "100",
+		accessControlEnvVarName:      `{"core": {"access": "everyone"}}`,
+		rateLimitsEnvVarName:         `{"*": {"rate": 0, "burst": 1}}`,
+		maxResponseSizeEnvVarName:    "-1",
+		entitlementsEnvVarName:       `{"core": {}}`,
+		endToEndEncryptionEnvVarName: `"core"`,
+		contentSchemasEnvVarName:     `{"core": "object"}`,
+	} {
+		_, err := loadConfig(testEnvWith(key, value))
+		assert.ErrorContains(t, err, "wrong `"+key+"`")
+	}
+}
+
+func TestThatModuleIsNotLoadedWithWrongConfiguration(t *testing.T) {
+	db, dbMock := createDbMock()
+	ctx := context.WithValue(context.Background(), runtime.RUNTIME_CTX_ENV, testEnvWith(rateLimitsEnvVarName, "not json"))
+
+	err := InitModule(ctx, buildLoggerMock(), db, buildNakamaModuleMock(t), nil)
+	assert.ErrorContains(t, err, "wrong `rate_limits`")
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatConfigurationIsReloadedWithSettings(t *testing.T) {
+	restoreConfigAfter(t)
+	db, dbMock := createDbMock()
+	dbMock.ExpectBegin()
+	dbMock.
+		ExpectExec("insert into downloader_audit_log").
+		WithArgs("server", "reload_config", "", "", nil, nil, "new limits").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+	mockNakamaModule := buildNakamaModuleMock(t)
+	mockNakamaModule.On("LeaderboardCreate", mock.Anything, mock.Anything, true, "desc", "incr", "", mock.Anything).Return(nil)
+	ctx := context.WithValue(context.Background(), runtime.RUNTIME_CTX_ENV, testEnv)
+
+	res, err := RpcDownloaderReloadConfig(ctx, buildLoggerMock(), db, mockNakamaModule,
+		`{"settings": {"max_file_sizes": "{\"custom\": 10}"}, "reason": "new limits"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", res)
+	assert.Equal(t, int64(10), maxFileSizeFor(currentConfig().MaxFileSizes, "custom"))
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatWrongSettingsDontReplaceConfiguration(t *testing.T) {
+	cfg := currentConfig()
+	db, _ := createDbMock()
+	ctx := context.WithValue(context.Background(), runtime.RUNTIME_CTX_ENV, testEnv)
+
+	_, err := RpcDownloaderReloadConfig(ctx, buildLoggerMock(), db, buildNakamaModuleMock(t), `{"settings": {"rate_limits": "[]"}}`)
+	assertErrorCode(t, err, invalidArgumentCode)
+	_, err = RpcDownloaderReloadConfig(ctx, buildLoggerMock(), db, buildNakamaModuleMock(t), `{"settings": {"schema_version": "1"}}`)
+	assertErrorCode(t, err, invalidArgumentCode)
+	assert.Same(t, cfg, currentConfig())
+}
+
+func TestThatConfigurationReloadIsNotAvailableToUsers(t *testing.T) {
+	db, _ := createDbMock()
+
+	_, err := RpcDownloaderReloadConfig(userContext("user-1"), buildLoggerMock(), db, buildNakamaModuleMock(t), "")
+	assertErrorCode(t, err, permissionDeniedCode)
+}
+
+// Run with -race: downloads read the configuration while it's reloaded.
+func TestThatConfigurationIsReloadedConcurrentlyWithDownloads(t *testing.T) {
+	restoreConfigAfter(t)
+	const reloads = 20
+	reloadDb, reloadDbMock := createDbMock()
+	reloadDbMock.MatchExpectationsInOrder(false)
+	for i := 0; i < reloads; i++ {
+		reloadDbMock.ExpectBegin()
+		reloadDbMock.ExpectExec("insert into downloader_audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+		reloadDbMock.ExpectCommit()
+	}
+	downloadDb, _ := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+	mockNakamaModule.On("LeaderboardCreate", mock.Anything, mock.Anything, true, "desc", "incr", "", mock.Anything).Return(nil).Maybe()
+	ctx := context.WithValue(context.Background(), runtime.RUNTIME_CTX_ENV, testEnv)
+
+	var wg sync.WaitGroup
+	for i := 0; i < reloads; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			_, err := RpcDownloaderReloadConfig(ctx, buildLoggerMock(), reloadDb, mockNakamaModule,
+				fmt.Sprintf(`{"settings": {"max_response_size": "%d"}}`, 1<<20+i))
+			assert.NoError(t, err)
+		}(i)
+		go func() {
+			defer wg.Done()
+			res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), downloadDb, mockNakamaModule, buildPayload("custom", "5.0.0", nil))
+			if assert.NoError(t, err) {
+				assert.Equal(t, "3181399843", *unmarshalResponse(res).Hash)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, reloadDbMock.ExpectationsWereMet())
+}
+
+func restoreConfigAfter(t *testing.T) {
+	previous := currentConfig()
+	t.Cleanup(func() { activeConfig.Store(previous) })
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"regexp"
+)
+
+const configFileEnvVarName string = "config_file"
+
+const defaultExtension = ".json"
+
+// The only supported storage of content, the setting is reserved for other storages, e.g. object storages.
+const filesystemBackend = "filesystem"
+
+var extensionPattern = regexp.MustCompile(`^\.[A-Za-z0-9_-]+$`)
+
+/*
+The config file describes global settings and settings of every type, `*` is applied to types which
+don't have their own settings:
+
+	default_type: core
+	default_file_path: /data
+	types:
+	  core:
+	    default_version: 1.0.0
+	    max_file_size: 1048576
+	    access: public
+	  beta:
+	    access: restricted
+	    groups: [beta-testers]
+	    schema: {type: object, required: [levels]}
+
+Keys are the same as the names of the env vars, see README for the full list.
+*/
+type configFile struct {
+	DefaultType         string                    `yaml:"default_type"`
+	DefaultVersion      string                    `yaml:"default_version"`
+	DefaultFilePath     string                    `yaml:"default_file_path"`
+	ContentRoots        []contentRoot             `yaml:"content_roots"`
+	SchemaVersion       *int                      `yaml:"schema_version"`
+	MaxResponseSize     *int64                    `yaml:"max_response_size"`
+	DownloadTokenSecret string                    `yaml:"download_token_secret"`
+	Types               map[string]typeConfigFile `yaml:"types"`
+}
+
+type typeConfigFile struct {
+	Extension          string       `yaml:"extension"`
+	DefaultVersion     string       `yaml:"default_version"`
+	MaxFileSize        *int64       `yaml:"max_file_size"`
+	Access             string       `yaml:"access"`
+	Groups             []string     `yaml:"groups"`
+	MetadataFlag       string       `yaml:"metadata_flag"`
+	RateLimit          *rateLimit   `yaml:"rate_limit"`
+	Entitlement        *entitlement `yaml:"entitlement"`
+	EncryptionKey      string       `yaml:"encryption_key"`
+	EndToEndEncryption *bool        `yaml:"end_to_end_encryption"`
+	Schema             interface{}  `yaml:"schema"`
+	Backend            string       `yaml:"backend"`
+}
+
+/*
+Applies the config file to the configuration. Unknown keys are rejected, so a typo doesn't silently
+leave the default value. Errors point to the offending key, e.g. `types.core.max_file_size: must be positive`.
+*/
+func applyConfigFile(cfg *moduleConfig, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file configFile
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&file)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	if file.DefaultType != "" {
+		if err = validateName("type", file.DefaultType); err != nil {
+			return fmt.Errorf("default_type: %w", err)
+		}
+		cfg.DefaultType = file.DefaultType
+	}
+	if file.DefaultVersion != "" {
+		if err = validateName("version", file.DefaultVersion); err != nil {
+			return fmt.Errorf("default_version: %w", err)
+		}
+		cfg.DefaultVersion = file.DefaultVersion
+	}
+	if file.DefaultFilePath != "" {
+		cfg.FilePath = file.DefaultFilePath
+	}
+	if file.ContentRoots != nil {
+		// Roots are validated after the env is applied, when the default root is known.
+		cfg.Roots = file.ContentRoots
+	}
+	if file.SchemaVersion != nil {
+		if *file.SchemaVersion < 0 || *file.SchemaVersion > latestSchemaVersion() {
+			return fmt.Errorf("schema_version: must be a number between 0 and %d", latestSchemaVersion())
+		}
+		cfg.SchemaVersion = file.SchemaVersion
+	}
+	if file.MaxResponseSize != nil {
+		if *file.MaxResponseSize <= 0 {
+			return fmt.Errorf("max_response_size: must be positive")
+		}
+		cfg.MaxResponseSize = *file.MaxResponseSize
+	}
+	cfg.DownloadTokenSecret = file.DownloadTokenSecret
+
+	for typeName, settings := range file.Types {
+		if typeName != anyTypeKey {
+			if err = validateName("type", typeName); err != nil {
+				return fmt.Errorf("types.%s: %w", typeName, err)
+			}
+		}
+		if err = applyTypeConfigFile(cfg, typeName, settings); err != nil {
+			return fmt.Errorf("types.%s.%w", typeName, err)
+		}
+	}
+	return nil
+}
+
+func applyTypeConfigFile(cfg *moduleConfig, typeName string, settings typeConfigFile) error {
+	if settings.Backend != "" && settings.Backend != filesystemBackend {
+		return fmt.Errorf("backend: unknown backend %q, only %q is supported", settings.Backend, filesystemBackend)
+	}
+	if settings.Extension != "" {
+		if !extensionPattern.MatchString(settings.Extension) {
+			return fmt.Errorf("extension: must be a dot followed by letters, digits, `_` or `-`")
+		}
+		cfg.Extensions[typeName] = settings.Extension
+	}
+	if settings.DefaultVersion != "" {
+		if err := validateName("version", settings.DefaultVersion); err != nil {
+			return fmt.Errorf("default_version: %w", err)
+		}
+		cfg.DefaultVersions[typeName] = settings.DefaultVersion
+	}
+	if settings.MaxFileSize != nil {
+		if *settings.MaxFileSize <= 0 {
+			return fmt.Errorf("max_file_size: must be positive")
+		}
+		cfg.MaxFileSizes[typeName] = *settings.MaxFileSize
+	}
+	if settings.Access != "" {
+		rule := accessRule{Access: settings.Access, Groups: settings.Groups, MetadataFlag: settings.MetadataFlag}
+		if err := validateAccessRule(rule); err != nil {
+			return fmt.Errorf("access: %w", err)
+		}
+		cfg.AccessRules[typeName] = rule
+	} else if len(settings.Groups) > 0 || settings.MetadataFlag != "" {
+		return fmt.Errorf("access: must be %q to use groups or a metadata flag", accessRestricted)
+	}
+	if settings.RateLimit != nil {
+		if err := validateRateLimit(*settings.RateLimit); err != nil {
+			return fmt.Errorf("rate_limit: %w", err)
+		}
+		cfg.RateLimits[typeName] = *settings.RateLimit
+	}
+	if settings.Entitlement != nil {
+		if err := validateEntitlement(*settings.Entitlement); err != nil {
+			return fmt.Errorf("entitlement: %w", err)
+		}
+		cfg.Entitlements[typeName] = *settings.Entitlement
+	}
+	if settings.EncryptionKey != "" {
+		key, err := decodeEncryptionKey(settings.EncryptionKey)
+		if err != nil {
+			return fmt.Errorf("encryption_key: %w", err)
+		}
+		cfg.EncryptionKeys[typeName] = key
+	}
+	if settings.EndToEndEncryption != nil {
+		cfg.EndToEndEncrypted[typeName] = *settings.EndToEndEncryption
+	}
+	if settings.Schema != nil {
+		// The schema is converted to JSON, so numbers are decoded the same way as in content.
+		raw, err := json.Marshal(settings.Schema)
+		if err != nil {
+			return fmt.Errorf("schema: %w", err)
+		}
+		cfg.ContentSchemas[typeName], err = parseContentSchema(typeName, raw)
+		if err != nil {
+			return fmt.Errorf("schema: %w", err)
+		}
+	}
+	return nil
+}
+
+func extensionFor(extensions map[string]string, typeName string) string {
+	if extension, ok := extensions[typeName]; ok {
+		return extension
+	}
+	if extension, ok := extensions[anyTypeKey]; ok {
+		return extension
+	}
+	return defaultExtension
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "downloader.yml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestThatConfigFileDescribesTypes(t *testing.T) {
+	path := writeConfigFile(t, `
+default_type: core
+default_file_path: ./test_data
+max_response_size: 4096
+types:
+  core:
+    default_version: 1.0.0
+    max_file_size: 1024
+  beta:
+    extension: .txt
+    access: restricted
+    groups: [beta-testers]
+    rate_limit: {rate: 1, burst: 5}
+    schema: {type: object, required: [levels]}
+    backend: filesystem
+`)
+
+	cfg, err := loadConfig(map[string]string{configFileEnvVarName: path})
+	assert.NoError(t, err)
+	assert.Equal(t, "core", cfg.DefaultType)
+	assert.Equal(t, int64(4096), cfg.MaxResponseSize)
+	assert.Equal(t, "1.0.0", cfg.DefaultVersions["core"])
+	assert.Equal(t, int64(1024), maxFileSizeFor(cfg.MaxFileSizes, "core"))
+	assert.Equal(t, accessRule{Access: accessRestricted, Groups: []string{"beta-testers"}}, cfg.AccessRules["beta"])
+	assert.Equal(t, rateLimit{Rate: 1, Burst: 5}, cfg.RateLimits["beta"])
+	assert.Equal(t, ".txt", extensionFor(cfg.Extensions, "beta"))
+	assert.Equal(t, ".json", extensionFor(cfg.Extensions, "core"))
+	assert.Equal(t, []string{`/: missing required property "levels"`}, validateContent(cfg.ContentSchemas["beta"], []byte(`{}`)))
+}
+
+func TestThatEnvOverridesConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+default_type: custom
+default_file_path: /data
+types:
+  core:
+    max_file_size: 1024
+`)
+
+	cfg, err := loadConfig(testEnvWith(configFileEnvVarName, path))
+	assert.NoError(t, err)
+	assert.Equal(t, "core", cfg.DefaultType)
+	assert.Equal(t, "./test_data", cfg.FilePath)
+	assert.Equal(t, int64(1024), maxFileSizeFor(cfg.MaxFileSizes, "core"))
+}
+
+func TestThatConfigFileErrorsPointToTheKey(t *testing.T) {
+	for content, expected := range map[string]string{
+		"types:\n  core:\n    max_file_size: 0\n":      "types.core.max_file_size: must be positive",
+		"types:\n  core:\n    access: everyone\n":      "types.core.access: unknown access \"everyone\"",
+		"types:\n  core:\n    backend: s3\n":           "types.core.backend: unknown backend \"s3\"",
+		"types:\n  core:\n    extension: json\n":       "types.core.extension: must be a dot",
+		"types:\n  core:\n    rate_limit: {rate: 0}\n": "types.core.rate_limit:",
+		"types:\n  core:\n    encryption_key: short\n": "types.core.encryption_key:",
+		"types:\n  core:\n    schema: object\n":        "types.core.schema: schema of core must be an object or a boolean",
+		"types:\n  ../core: {}\n":                      "types.../core:",
+		"types:\n  core:\n    max_size: 10\n":          "field max_size not found",
+		"schema_version: 100\n":                        "schema_version: must be a number between 0 and",
+	} {
+		path := writeConfigFile(t, content)
+		_, err := loadConfig(testEnvWith(configFileEnvVarName, path))
+		assert.ErrorContains(t, err, "wrong config file `"+path+"`: ")
+		assert.ErrorContains(t, err, expected, content)
+	}
+}
+
+func TestThatContentWithCustomExtensionIsServed(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "notes"), 0o700))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "notes", "1.0.0.txt"), []byte(`"hello"`), 0o600))
+	path := writeConfigFile(t, "types:\n  notes:\n    extension: .txt\n")
+	restoreConfigAfter(t)
+	cfg, err := loadConfig(map[string]string{defaultTypeEnvVarName: "notes", defaultFilePathEnvVarName: root, configFileEnvVarName: path})
+	assert.NoError(t, err)
+	activeConfig.Store(cfg)
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("notes", "1.0.0", nil))
+	assert.NoError(t, err)
+	resp := unmarshalResponse(res)
+	assert.Equal(t, `"hello"`, *resp.Content)
+	res, err = RpcFileList(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "notes"}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"types": [{"type": "notes", "versions": ["1.0.0"]}]}`, res)
+}
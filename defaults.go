@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const defaultVersionsEnvVarName = "default_versions"
+
+// An alias with this name overrides the configured default version of its type without a restart.
+const defaultAlias = "default"
+
+/*
+Returns the version which is served if the request omits it: the `default` alias of the type, then the version
+from the `default_versions` env var, then `default_version` for the default type only, then the `*` entry of
+`default_versions`. Other types don't fall back to `default_version`: it's a version of another type and usually
+doesn't exist.
+*/
+func defaultVersionFor(ctx context.Context, logger runtime.Logger, db *sql.DB, cfg *moduleConfig, typeName string) (string, error) {
+	snapshot, err := currentContentMetadata(ctx, logger, db)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := snapshot.alias(typeName, defaultAlias); ok {
+		return defaultAlias, nil
+	}
+	if version, ok := cfg.DefaultVersions[typeName]; ok {
+		return version, nil
+	}
+	if cfg.DefaultVersion != "" && typeName == cfg.DefaultType {
+		return cfg.DefaultVersion, nil
+	}
+	if version, ok := cfg.DefaultVersions[anyTypeKey]; ok {
+		return version, nil
+	}
+	return "", runtime.NewError(fmt.Sprintf("`version` is required, `%s` has no default version", typeName), invalidArgumentCode)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestThatOmittedVersionIsReplacedByDefaultVersionOfType(t *testing.T) {
+	setConfigValue(t, defaultVersionsEnvVarName, `{"custom": "5.0.0"}`)
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom"}`)
+	assert.NoError(t, err)
+	response := unmarshalResponse(res)
+	assert.Equal(t, "5.0.0", response.Version)
+	assert.Equal(t, "3181399843", *response.Hash)
+}
+
+func TestThatGlobalDefaultVersionIsUsedOnlyForDefaultType(t *testing.T) {
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "core"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.0", unmarshalResponse(res).Version)
+	_, err = RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom"}`)
+	assert.EqualError(t, err, "`version` is required, `custom` has no default version")
+	assertErrorCode(t, err, invalidArgumentCode)
+}
+
+func TestThatDefaultAliasOverridesConfiguredDefaultVersion(t *testing.T) {
+	setConfigValue(t, defaultVersionsEnvVarName, `{"custom": "4.0.0"}`)
+	useContentAliases(t, map[contentKey]string{{Type: "custom", Version: defaultAlias}: "5.0.0"})
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom"}`)
+	assert.NoError(t, err)
+	response := unmarshalResponse(res)
+	assert.Equal(t, "5.0.0", response.Version)
+	assert.Equal(t, defaultAlias, *response.Alias)
+}
+
+func TestThatWrongDefaultVersionsConfigIsRejected(t *testing.T) {
+	_, err := loadConfig(testEnvWith(defaultVersionsEnvVarName, `["5.0.0"]`))
+	assert.Error(t, err)
+	_, err = loadConfig(testEnvWith(defaultVersionsEnvVarName, `{"custom": "../5.0.0"}`))
+	assert.Error(t, err)
+}
+
+func TestThatDefaultVersionOfAnyTypeIsUsedLast(t *testing.T) {
+	setConfigValue(t, defaultVersionsEnvVarName, `{"*": "5.0.0"}`)
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "5.0.0", unmarshalResponse(res).Version)
+	res, err = RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "core"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.0", unmarshalResponse(res).Version)
+}
@@ -4,30 +4,40 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/heroiclabs/nakama-common/runtime"
 	"hash/crc32"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const defaultTypeEnvVarName string = "default_type"
 const defaultVersionEnvVarName string = "default_version"
 const defaultFilePathEnvVarName string = "default_file_path"
 
-// I decided not to add google.golang.org/grpc to the dependencies list just for 3 status codes.
+// I decided not to add google.golang.org/grpc to the dependencies list just for a few status codes.
 const invalidArgumentCode = 3
 const notFoundCode = 5
+const alreadyExistsCode = 6
+const permissionDeniedCode = 7
+const resourceExhaustedCode = 8
+const failedPreconditionCode = 9
 const internalErrorCode = 13
-
-var config = make(map[string]string)
+const unavailableCode = 14
 
 type DownloaderRequest struct {
 	Type    string  `json:"type"`
 	Version string  `json:"version"`
 	Hash    *string `json:"hash,omitempty"`
+	// A token issued by the FileDownloadToken RPC, it's checked instead of access control rules and entitlements.
+	Token *string `json:"token,omitempty"`
+	// A base64-encoded ephemeral X25519 public key, the content is encrypted for it if set.
+	ClientPublicKey *string `json:"client_public_key,omitempty"`
+	// An empty version is invalid, while an omitted one is replaced by the default version of the type.
+	versionOmitted bool
 }
 
 type DownloaderResponse struct {
@@ -35,55 +45,206 @@ type DownloaderResponse struct {
 	Version string  `json:"version"`
 	Hash    *string `json:"hash"`
 	Content *string `json:"content"`
+	// Set only if the content is encrypted for the client, see encryptForClient.
+	Encryption *ResponseEncryption `json:"encryption,omitempty"`
+	// The version is going to be deleted, the replacement is the version which clients should switch to.
+	Deprecated  bool    `json:"deprecated,omitempty"`
+	Replacement *string `json:"replacement,omitempty"`
+	// The alias from the request, e.g. `live`, if the version was resolved from it.
+	Alias *string `json:"alias,omitempty"`
 }
 
 func RpcFileDownloader(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
-	req, err := unmarshalRequest(payload, logger)
+	// The configuration is loaded once, so a concurrent reload can't mix settings of two configurations in one request.
+	cfg := currentConfig()
+	req, err := unmarshalRequest(cfg, payload, logger)
 	if err != nil {
+		reportFailure(ctx, nk, logger, req, outcomeInvalid)
 		return "{}", err
 	}
 
+	if req.versionOmitted {
+		err = validateName("type", req.Type)
+		if err == nil {
+			req.Version, err = defaultVersionFor(ctx, logger, db, cfg, req.Type)
+		}
+		if err != nil {
+			reportFailure(ctx, nk, logger, req, outcomeInvalid)
+			return "{}", err
+		}
+	}
+
 	err = validateRequest(req)
 	if err != nil {
+		reportFailure(ctx, nk, logger, req, outcomeInvalid)
+		return "{}", err
+	}
+
+	err = checkEndToEndEncryption(cfg.EndToEndEncrypted, req)
+	if err != nil {
+		reportFailure(ctx, nk, logger, req, outcomeInvalid)
+		return "{}", err
+	}
+
+	err = checkRateLimit(ctx, downloadLimiter, cfg.RateLimits, req.Type)
+	if err != nil {
+		reportFailure(ctx, nk, logger, req, outcomeRateLimited)
+		return "{}", err
+	}
+
+	if req.Token != nil {
+		err = checkDownloadToken(ctx, cfg, *req.Token, req, time.Now())
+	} else {
+		err = checkAccess(ctx, nk, cfg.AccessRules, req.Type)
+		if err == nil {
+			err = checkEntitlement(ctx, nk, cfg.Entitlements, req.Type)
+		}
+	}
+	if err != nil {
+		reportFailure(ctx, nk, logger, req, outcomeDenied)
 		return "{}", err
 	}
 
-	filePath, err := buildFilePath(req.Type, req.Version)
+	// Tokens are checked before the resolution, so a token issued for an alias keeps working after a promotion.
+	requestedVersion := req.Version
+	req.Version, err = resolveVersion(ctx, logger, db, cfg, req.Type, req.Version)
 	if err != nil {
+		reportFailure(ctx, nk, logger, req, outcomeError)
 		return "{}", err
 	}
 
-	f, err := os.ReadFile(filePath)
+	filePath, err := buildFilePath(cfg, req.Type, req.Version)
 	if err != nil {
+		reportFailure(ctx, nk, logger, req, outcomeError)
+		return "{}", err
+	}
+
+	metadata, err := versionMetadataFor(ctx, logger, db, req.Type, req.Version)
+	if err != nil {
+		reportFailure(ctx, nk, logger, req, outcomeError)
+		return "{}", err
+	}
+	if metadata.RemovedAt != nil {
+		reportFailure(ctx, nk, logger, req, outcomeRemoved)
+		return "{}", removedError(req.Type, req.Version, metadata.Replacement)
+	}
+	// Versions outside of their publication window are reported exactly as missing files.
+	available, err := checkVersionAvailable(ctx, logger, db, nk, req.Type, req.Version)
+	if err != nil {
+		reportFailure(ctx, nk, logger, req, outcomeError)
+		return "{}", err
+	}
+	if !available {
+		reportFailure(ctx, nk, logger, req, outcomeNotFound)
 		return "{}", runtime.NewError(fmt.Sprintf("File not found on path: %s", filePath), notFoundCode)
 	}
+	if quarantinedContent.contains(req.Type, req.Version) {
+		reportFailure(ctx, nk, logger, req, outcomeQuarantined)
+		return "{}", quarantinedError(req.Type, req.Version)
+	}
 
-	crc32Table := crc32.MakeTable(crc32.IEEE)
-	fileCrc32 := strconv.FormatUint(uint64(crc32.Checksum(f, crc32Table)), 10)
+	readStartedAt := time.Now()
+	resolvedPath, err := resolveFilePath(cfg, filePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("Unable to resolve requested file: %v", err)
+		}
+		reportFailure(ctx, nk, logger, req, outcomeNotFound)
+		return "{}", runtime.NewError(fmt.Sprintf("File not found on path: %s", filePath), notFoundCode)
+	}
+	maxFileSize := maxFileSizeFor(cfg.MaxFileSizes, req.Type)
+	f, err := readFileWithLimit(resolvedPath, maxFileSize)
+	if errors.Is(err, errFileTooLarge) {
+		logger.Warn("Requested file exceeds the maximum size: %s", resolvedPath)
+		reportFailure(ctx, nk, logger, req, outcomeTooLarge)
+		return "{}", fileTooLargeError(req.Type, maxFileSize)
+	}
+	if err != nil {
+		reportFailure(ctx, nk, logger, req, outcomeNotFound)
+		return "{}", runtime.NewError(fmt.Sprintf("File not found on path: %s", filePath), notFoundCode)
+	}
+	recordLatency(nk, fileReadLatencyMetricName, req.Type, readStartedAt)
+
+	if key, ok := encryptionKeyFor(cfg.EncryptionKeys, req.Type); ok {
+		f, err = decryptContent(key, req.Type, f)
+		if err != nil {
+			logger.Error("Unable to decrypt %s: %v", resolvedPath, err)
+			reportFailure(ctx, nk, logger, req, outcomeError)
+			return "{}", runtime.NewError("Unable to read the file", internalErrorCode)
+		}
+	}
+
+	hashingStartedAt := time.Now()
+	fileCrc32 := contentHash(f)
+	recordLatency(nk, hashingLatencyMetricName, req.Type, hashingStartedAt)
 	var resp DownloaderResponse
+	var outcome string
 	if req.Hash != nil && fileCrc32 != *req.Hash {
 		resp = DownloaderResponse{Type: req.Type, Version: req.Version, Hash: req.Hash, Content: nil}
+		outcome = outcomeHashMismatch
 	} else {
 		content := string(f)
 		resp = DownloaderResponse{Type: req.Type, Version: req.Version, Hash: &fileCrc32, Content: &content}
+		outcome = outcomeServed
+		if req.ClientPublicKey != nil {
+			resp, err = encryptForClient(resp, *req.ClientPublicKey)
+			if err != nil {
+				reportFailure(ctx, nk, logger, req, outcomeInvalid)
+				return "{}", err
+			}
+		}
+	}
+	if req.Version != requestedVersion {
+		resp.Alias = &requestedVersion
+	}
+	if metadata.Deprecated {
+		resp.Deprecated = true
+		if metadata.Replacement != "" {
+			resp.Replacement = &metadata.Replacement
+		}
 	}
-	writeStatistics(resp, filePath, db, logger)
 	respStr, err := json.Marshal(resp)
 	if err != nil {
 		return "{}", err
 	}
+	if int64(len(respStr)) > cfg.MaxResponseSize {
+		reportFailure(ctx, nk, logger, req, outcomeTooLarge)
+		return "{}", responseTooLargeError(cfg.MaxResponseSize)
+	}
+
+	recordOutcome(nk, req, outcome)
+	recordBytesServed(nk, resp)
+	publishDownloadEvent(ctx, nk, logger, resp, outcome)
+	incrementPopularContent(ctx, nk, logger, resp)
+	writeStatistics(resp, db, nk, logger)
 	return string(respStr[:]), nil
 }
 
-func unmarshalRequest(payload string, logger runtime.Logger) (DownloaderRequest, error) {
-	req, err := buildDefaultRequest()
-	if err != nil {
-		return req, nil
-	}
+// Failed requests have no content, so their events contain only the requested type and version.
+func reportFailure(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, req DownloaderRequest, outcome string) {
+	recordOutcome(nk, req, outcome)
+	publishDownloadEvent(ctx, nk, logger, DownloaderResponse{Type: req.Type, Version: req.Version}, outcome)
+}
+
+func contentHash(content []byte) string {
+	crc32Table := crc32.MakeTable(crc32.IEEE)
+	return strconv.FormatUint(uint64(crc32.Checksum(content, crc32Table)), 10)
+}
+
+func unmarshalRequest(cfg *moduleConfig, payload string, logger runtime.Logger) (DownloaderRequest, error) {
+	req := buildDefaultRequest(cfg)
+	req.versionOmitted = true
 	if strings.TrimSpace(payload) == "" {
 		return req, nil
 	}
-	err = json.Unmarshal([]byte(payload), &req)
+	var fields struct {
+		Version *string `json:"version"`
+	}
+	err := json.Unmarshal([]byte(payload), &fields)
+	if err == nil {
+		req.versionOmitted = fields.Version == nil
+		err = json.Unmarshal([]byte(payload), &req)
+	}
 	if err != nil {
 		/*
 			Since it is more likely a client's error, it's better to log it at a lower logging level than 'error'
@@ -102,53 +263,48 @@ func unmarshalRequest(payload string, logger runtime.Logger) (DownloaderRequest,
 	return req, nil
 }
 
-func buildDefaultRequest() (DownloaderRequest, error) {
-	defaultType, err := lookupEnvVarOrGetFromCache(defaultTypeEnvVarName)
-	if err != nil {
-		return DownloaderRequest{}, err
-	}
-	defaultVersion, err := lookupEnvVarOrGetFromCache(defaultVersionEnvVarName)
-	if err != nil {
-		return DownloaderRequest{}, err
-	}
-
-	return DownloaderRequest{Type: defaultType, Version: defaultVersion}, nil
+// The version is left empty, it depends on the type and is filled by defaultVersionFor.
+func buildDefaultRequest(cfg *moduleConfig) DownloaderRequest {
+	return DownloaderRequest{Type: cfg.DefaultType}
 }
 
-func lookupEnvVarOrGetFromCache(key string) (string, error) {
-	value, ok := config[key]
-	if !ok {
-		value, exists := os.LookupEnv(key)
-		if !exists {
-			return "", runtime.NewError("Wrong service configuration", internalErrorCode)
-		}
-		config[key] = value
-		return value, nil
-	}
-
-	return value, nil
+func buildFilePath(cfg *moduleConfig, typeName string, version string) (string, error) {
+	root := findContentRoot(cfg, typeName, version)
+	return contentFilePath(cfg, root.Path, typeName, version), nil
 }
 
-func buildFilePath(typeName string, version string) (string, error) {
-	defaultPath, err := lookupEnvVarOrGetFromCache(defaultFilePathEnvVarName)
+// Every folder inside the root folder is a content type.
+func listContentTypes(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return filepath.Join(defaultPath, typeName, version) + ".json", nil
+	var types []string
+	for _, entry := range entries {
+		if entry.IsDir() && validateName("type", entry.Name()) == nil {
+			types = append(types, entry.Name())
+		}
+	}
+	return types, nil
 }
 
-func writeStatistics(resp DownloaderResponse, filePath string, db *sql.DB, logger runtime.Logger) {
+func writeStatistics(resp DownloaderResponse, db *sql.DB, nk runtime.NakamaModule, logger runtime.Logger) {
 	if resp.Content == nil {
 		// Right now the method only stores statistics for existing files with matched hash.
 		return
 	}
+	/*
+		Statistics are keyed by the logical type and version rather than by the file path,
+		so they survive changes of `default_file_path` or of the mount point.
+	*/
 	_, err := db.Exec(`
-		insert into download_statistics(file_name, file_hash, download_count)
-		values($1, $2, $3)
-		on conflict(file_name, file_hash) do update
+		insert into download_statistics(type, version, file_hash, download_count)
+		values($1, $2, $3, $4)
+		on conflict(type, version, file_hash) do update
 		    set download_count = download_statistics.download_count + 1
-	`, filePath, resp.Hash, 1)
+	`, resp.Type, resp.Version, resp.Hash, 1)
 	if err != nil {
+		recordStatisticsWriteFailure(nk)
 		logger.Error("Failed to save statistics to database: %e", err)
 	}
 }
@@ -159,17 +315,12 @@ func validateRequest(req DownloaderRequest) error {
 		`/../../core`. If such value will be passed to filepath.Join, then the RPC will provide the ability to
 		get any file outside the desired folder. It'll be a serious vulnerability.
 
-		Linux does not allow only 2 characters in folder names: / and /0. It looks like that
-		checking for absence of `/` is enough in the current case.
+		Names are checked against a whitelist (see validateName), and the final path is checked once again
+		after evaluation of symlinks (see resolveFilePath).
 	*/
-
-	if strings.Contains(req.Type, "/") {
-		return runtime.NewError("`type` field must not contain /", invalidArgumentCode)
-	}
-
-	if strings.Contains(req.Version, "/") {
-		return runtime.NewError("`version` field must not contain /", invalidArgumentCode)
+	err := validateName("type", req.Type)
+	if err != nil {
+		return err
 	}
-
-	return nil
+	return validateName("version", req.Version)
 }
@@ -5,22 +5,30 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
-	"os"
 	mocks "pendyurinandrey.com/nakama-downloader-module/mocks/github.com/heroiclabs/nakama-common/runtime"
 	"testing"
+	"time"
 )
 import "github.com/DATA-DOG/go-sqlmock"
 
 func init() {
-	setEnvVars()
+	cfg, err := loadConfig(testEnv)
+	if err != nil {
+		panic(err)
+	}
+	activeConfig.Store(cfg)
+	// Tests don't have the metadata table, versions without metadata are always available.
+	contentMetadata.store(emptyContentMetadata())
 }
 
 func TestThatBlankPayloadWillBeParsedAsDefaultRequest(t *testing.T) {
 	db, _ := createDbMock()
 	mockLogger := buildLoggerMock()
-	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule := buildNakamaModuleMock(t)
 
 	res, err := RpcFileDownloader(context.Background(), mockLogger, db, mockNakamaModule, "")
 	assert.NoError(t, err)
@@ -34,7 +42,7 @@ func TestThatBlankPayloadWillBeParsedAsDefaultRequest(t *testing.T) {
 func TestThatDownloaderWillReturnDataOfCustomTypeWith5_0_0Version(t *testing.T) {
 	db, _ := createDbMock()
 	mockLogger := buildLoggerMock()
-	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule := buildNakamaModuleMock(t)
 	payload := buildPayload("custom", "5.0.0", nil)
 
 	res, err := RpcFileDownloader(context.Background(), mockLogger, db, mockNakamaModule, payload)
@@ -49,17 +57,13 @@ func TestThatDownloaderWillReturnDataOfCustomTypeWith5_0_0Version(t *testing.T)
 func TestThatStatisticsWillBeStoredToDatabase(t *testing.T) {
 	db, dbMock := createDbMock()
 	mockLogger := buildLoggerMock()
-	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule := buildNakamaModuleMock(t)
 	payload := buildPayload("custom", "5.0.0", nil)
-	expectedPath, err := buildFilePath("custom", "5.0.0")
-	if err != nil {
-		panic(err)
-	}
 	dbMock.
 		ExpectExec("insert into download_statistics").
-		WithArgs(expectedPath, "3181399843", 1).
+		WithArgs("custom", "5.0.0", "3181399843", 1).
 		WillReturnResult(sqlmock.NewResult(1, 1))
-	_, err = RpcFileDownloader(context.Background(), mockLogger, db, mockNakamaModule, payload)
+	_, err := RpcFileDownloader(context.Background(), mockLogger, db, mockNakamaModule, payload)
 	assert.NoError(t, err)
 	err = dbMock.ExpectationsWereMet()
 	assert.NoError(t, err)
@@ -68,7 +72,7 @@ func TestThatStatisticsWillBeStoredToDatabase(t *testing.T) {
 func TestThatContentWillBeEmptyIfHashCodesDoNotMatch(t *testing.T) {
 	db, _ := createDbMock()
 	mockLogger := buildLoggerMock()
-	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule := buildNakamaModuleMock(t)
 	hash := "notcrc32"
 	payload := buildPayload("custom", "5.0.0", &hash)
 
@@ -84,11 +88,11 @@ func TestThatContentWillBeEmptyIfHashCodesDoNotMatch(t *testing.T) {
 func TestThatErrorWillBeRaisedIfFileIsNotFound(t *testing.T) {
 	db, _ := createDbMock()
 	mockLogger := buildLoggerMock()
-	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule := buildNakamaModuleMock(t)
 	payload := buildPayload("non_existing_type", "5.0.0", nil)
 
 	res, rpcErr := RpcFileDownloader(context.Background(), mockLogger, db, mockNakamaModule, payload)
-	expectedFilePath, err := buildFilePath("non_existing_type", "5.0.0")
+	expectedFilePath, err := buildFilePath(currentConfig(), "non_existing_type", "5.0.0")
 	if err != nil {
 		panic(err)
 	}
@@ -99,7 +103,7 @@ func TestThatErrorWillBeRaisedIfFileIsNotFound(t *testing.T) {
 func TestThatErrorWillBeRaisedIfTypeContainsBackslash(t *testing.T) {
 	db, _ := createDbMock()
 	mockLogger := buildLoggerMock()
-	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule := buildNakamaModuleMock(t)
 	payload := buildPayload("../../core", "5.0.0", nil)
 
 	res, rpcErr := RpcFileDownloader(context.Background(), mockLogger, db, mockNakamaModule, payload)
@@ -110,7 +114,7 @@ func TestThatErrorWillBeRaisedIfTypeContainsBackslash(t *testing.T) {
 func TestThatErrorWillBeRaisedIfVersionContainsBackslash(t *testing.T) {
 	db, _ := createDbMock()
 	mockLogger := buildLoggerMock()
-	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule := buildNakamaModuleMock(t)
 	payload := buildPayload("core", "../5.0.0", nil)
 
 	res, rpcErr := RpcFileDownloader(context.Background(), mockLogger, db, mockNakamaModule, payload)
@@ -118,6 +122,79 @@ func TestThatErrorWillBeRaisedIfVersionContainsBackslash(t *testing.T) {
 	assert.Equal(t, "{}", res)
 }
 
+func TestThatServedRequestIsCountedInMetrics(t *testing.T) {
+	db, _ := createDbMock()
+	mockLogger := buildLoggerMock()
+	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule.On("MetricsTimerRecord", mock.Anything, map[string]string{"type": "custom"}, mock.Anything).Return().Twice()
+	mockNakamaModule.On("MetricsCounterAdd", requestsMetricName, map[string]string{"type": "custom", "version": "5.0.0", "outcome": outcomeServed}, int64(1)).Return().Once()
+	mockNakamaModule.On("MetricsCounterAdd", bytesServedMetricName, map[string]string{"type": "custom", "version": "5.0.0"}, int64(19)).Return().Once()
+	// The database mock has no expectations, so writing statistics fails.
+	mockNakamaModule.On("MetricsCounterAdd", statisticsWriteFailuresMetricName, map[string]string{}, int64(1)).Return().Once()
+	mockNakamaModule.On("Event", mock.Anything, mock.Anything).Return(nil).Once()
+	mockNakamaModule.On("LeaderboardRecordWrite", mock.Anything, mock.Anything, mock.Anything, mock.Anything,
+		mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil).Once()
+	payload := buildPayload("custom", "5.0.0", nil)
+
+	_, err := RpcFileDownloader(context.Background(), mockLogger, db, mockNakamaModule, payload)
+	assert.NoError(t, err)
+}
+
+func TestThatInvalidRequestIsCountedInMetricsWithoutTypeAndVersion(t *testing.T) {
+	db, _ := createDbMock()
+	mockLogger := buildLoggerMock()
+	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule.On("MetricsCounterAdd", requestsMetricName, map[string]string{"outcome": outcomeInvalid}, int64(1)).Return().Once()
+	mockNakamaModule.
+		On("Event", mock.Anything, mock.MatchedBy(func(evt *api.Event) bool {
+			return evt.Properties["outcome"] == outcomeInvalid
+		})).
+		Return(nil).Once()
+	payload := buildPayload("../../core", "5.0.0", nil)
+
+	_, err := RpcFileDownloader(context.Background(), mockLogger, db, mockNakamaModule, payload)
+	assert.Error(t, err)
+}
+
+func TestThatMissingFileIsCountedInMetricsWithoutTypeAndVersion(t *testing.T) {
+	db, _ := createDbMock()
+	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule.On("MetricsCounterAdd", requestsMetricName, map[string]string{"outcome": outcomeNotFound}, int64(1)).Return().Once()
+	mockNakamaModule.On("Event", mock.Anything, mock.Anything).Return(nil).Once()
+
+	_, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, mockNakamaModule, buildPayload("custom", "random-9731", nil))
+	assertErrorCode(t, err, notFoundCode)
+}
+
+func TestThatDownloadEventIsPublishedWithUserProperties(t *testing.T) {
+	db, _ := createDbMock()
+	mockLogger := buildLoggerMock()
+	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule.On("MetricsCounterAdd", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	mockNakamaModule.On("MetricsTimerRecord", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	mockNakamaModule.
+		On("Event", mock.Anything, mock.MatchedBy(func(evt *api.Event) bool {
+			return evt.Name == downloadEventName && assert.Equal(t, map[string]string{
+				"type":     "custom",
+				"version":  "5.0.0",
+				"outcome":  outcomeServed,
+				"hash":     "3181399843",
+				"user_id":  "user-1",
+				"username": "player",
+			}, evt.Properties)
+		})).
+		Return(nil).
+		Once()
+	mockNakamaModule.On("LeaderboardRecordWrite", mock.Anything, mock.Anything, mock.Anything, mock.Anything,
+		mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil).Once()
+	ctx := context.WithValue(context.Background(), runtime.RUNTIME_CTX_USER_ID, "user-1")
+	ctx = context.WithValue(ctx, runtime.RUNTIME_CTX_USERNAME, "player")
+	payload := buildPayload("custom", "5.0.0", nil)
+
+	_, err := RpcFileDownloader(ctx, mockLogger, db, mockNakamaModule, payload)
+	assert.NoError(t, err)
+}
+
 func createDbMock() (*sql.DB, sqlmock.Sqlmock) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -126,19 +203,71 @@ func createDbMock() (*sql.DB, sqlmock.Sqlmock) {
 	return db, mock
 }
 
-func setEnvVars() {
-	os.Setenv(defaultTypeEnvVarName, "core")
-	os.Setenv(defaultVersionEnvVarName, "1.0.0")
-	os.Setenv(defaultFilePathEnvVarName, "./test_data")
+// The configuration of tests, as if it was set in the runtime env of Nakama.
+var testEnv = map[string]string{
+	defaultTypeEnvVarName:     "core",
+	defaultVersionEnvVarName:  "1.0.0",
+	defaultFilePathEnvVarName: "./test_data",
+}
+
+func testEnvWith(key string, value string) map[string]string {
+	env := make(map[string]string, len(testEnv)+1)
+	for k, v := range testEnv {
+		env[k] = v
+	}
+	env[key] = value
+	return env
+}
+
+func setConfigValue(t *testing.T, key string, value string) {
+	env := testEnvWith(key, value)
+	cfg, err := loadConfig(env)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	previousEnv, previousConfig := testEnv, activeConfig.Swap(cfg)
+	testEnv = env
+	t.Cleanup(func() {
+		testEnv = previousEnv
+		activeConfig.Store(previousConfig)
+	})
+}
+
+func emptyContentMetadata() *contentMetadataSnapshot {
+	return &contentMetadataSnapshot{versions: map[contentKey]versionMetadata{}, expiresAt: time.Now().AddDate(100, 0, 0)}
+}
+
+func useContentMetadata(t *testing.T, versions map[contentKey]versionMetadata) {
+	contentMetadata.store(&contentMetadataSnapshot{versions: versions, expiresAt: time.Now().AddDate(100, 0, 0)})
+	t.Cleanup(func() { contentMetadata.store(emptyContentMetadata()) })
 }
 
 func buildLoggerMock() *mocks.LoggerMock {
 	mockLogger := mocks.LoggerMock{}
-	mockLogger.On("Info", mock.Anything, mock.Anything).Return(nil)
-	mockLogger.On("Error", mock.Anything, mock.Anything).Return(nil)
+	for _, level := range []string{"Info", "Warn", "Error"} {
+		mockLogger.On(level, mock.Anything).Return(nil)
+		mockLogger.On(level, mock.Anything, mock.Anything).Return(nil)
+		mockLogger.On(level, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		mockLogger.On(level, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	}
 	return &mockLogger
 }
 
+// Metrics, events and leaderboard records are written on every call, tests which check them set their own expectations.
+func buildNakamaModuleMock(t *testing.T) *mocks.NakamaModuleMock {
+	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule.On("MetricsCounterAdd", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	mockNakamaModule.On("MetricsTimerRecord", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	mockNakamaModule.On("MetricsGaugeSet", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	mockNakamaModule.On("Event", mock.Anything, mock.Anything).Return(nil).Maybe()
+	mockNakamaModule.On("LeaderboardRecordWrite", mock.Anything, mock.Anything, mock.Anything, mock.Anything,
+		mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil).Maybe()
+	mockNakamaModule.On("StorageWrite", mock.Anything, mock.Anything).Return(nil, nil).Maybe()
+	mockNakamaModule.On("StorageDelete", mock.Anything, mock.Anything).Return(nil).Maybe()
+	mockNakamaModule.On("StorageList", mock.Anything, "", "", catalogCollection, mock.Anything, mock.Anything).Return(nil, "", nil).Maybe()
+	return mockNakamaModule
+}
+
 func unmarshalResponse(res string) DownloaderResponse {
 	response := DownloaderResponse{}
 	err := json.Unmarshal([]byte(res), &response)
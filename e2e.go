@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const endToEndEncryptionEnvVarName string = "end_to_end_encryption"
+
+const endToEndAlgorithm = "X25519-HKDF-SHA256-AES-256-GCM"
+const endToEndKeyInfo = "nakama-downloader-module content"
+
+type ResponseEncryption struct {
+	Algorithm       string `json:"algorithm"`
+	ServerPublicKey string `json:"server_public_key"`
+	Nonce           string `json:"nonce"`
+}
+
+/*
+The `end_to_end_encryption` env var contains a JSON array of types which are served only encrypted
+to the requesting client, e.g. `["anticheat"]`. Content of other types is encrypted if the client asks for it
+by sending its key.
+*/
+func parseEndToEndEncryptedTypes(value string) (map[string]bool, error) {
+	var types []string
+	err := json.Unmarshal([]byte(value), &types)
+	if err != nil {
+		return nil, err
+	}
+	required := make(map[string]bool, len(types))
+	for _, typeName := range types {
+		required[typeName] = true
+	}
+	return required, nil
+}
+
+func checkEndToEndEncryption(required map[string]bool, req DownloaderRequest) error {
+	if endToEndRequiredFor(required, req.Type) && req.ClientPublicKey == nil {
+		return runtime.NewError(fmt.Sprintf("`client_public_key` is required for `%s`", req.Type), invalidArgumentCode)
+	}
+	return nil
+}
+
+// A type listed explicitly takes precedence over `*`, so the config file can exclude a type with `false`.
+func endToEndRequiredFor(required map[string]bool, typeName string) bool {
+	if value, ok := required[typeName]; ok {
+		return value
+	}
+	return required[anyTypeKey]
+}
+
+/*
+Encrypts the content for the client which sent an ephemeral X25519 public key. The server generates its own
+ephemeral key pair for every response, so the content can be decrypted only by the owner of the client's private key,
+and not by proxies or tools which inspect RPC traffic.
+
+The AES-256-GCM key is derived from the shared secret with HKDF-SHA256, where the salt is the client's public key
+followed by the server's public key and the info is `nakama-downloader-module content`. The additional
+authenticated data is `<type>/<version>/<hash>`, so the client can verify that it got the content it asked for.
+The hash remains the hash of the plain content.
+*/
+func encryptForClient(resp DownloaderResponse, encodedClientKey string) (DownloaderResponse, error) {
+	clientKeyBytes, err := base64.StdEncoding.DecodeString(encodedClientKey)
+	if err != nil {
+		return resp, runtime.NewError("`client_public_key` must be base64-encoded", invalidArgumentCode)
+	}
+	clientKey, err := ecdh.X25519().NewPublicKey(clientKeyBytes)
+	if err != nil {
+		return resp, runtime.NewError("`client_public_key` must be an X25519 public key", invalidArgumentCode)
+	}
+	serverKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return resp, err
+	}
+	sharedSecret, err := serverKey.ECDH(clientKey)
+	if err != nil {
+		return resp, runtime.NewError("`client_public_key` must be an X25519 public key", invalidArgumentCode)
+	}
+	salt := append(append([]byte{}, clientKey.Bytes()...), serverKey.PublicKey().Bytes()...)
+	aead, err := newContentCipher(hkdfSha256(sharedSecret, salt, []byte(endToEndKeyInfo)))
+	if err != nil {
+		return resp, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return resp, err
+	}
+	additionalData := []byte(resp.Type + "/" + resp.Version + "/" + *resp.Hash)
+	encrypted := base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, []byte(*resp.Content), additionalData))
+
+	resp.Content = &encrypted
+	resp.Encryption = &ResponseEncryption{
+		Algorithm:       endToEndAlgorithm,
+		ServerPublicKey: base64.StdEncoding.EncodeToString(serverKey.PublicKey().Bytes()),
+		Nonce:           base64.StdEncoding.EncodeToString(nonce),
+	}
+	return resp, nil
+}
+
+// RFC 5869 for a 32-byte output, which needs a single block of the expand step.
+func hkdfSha256(secret []byte, salt []byte, info []byte) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"hash/crc32"
+	"strconv"
+	"testing"
+)
+
+func TestThatContentIsEncryptedForClientKey(t *testing.T) {
+	db, _ := createDbMock()
+	clientKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	encodedClientKey := base64.StdEncoding.EncodeToString(clientKey.PublicKey().Bytes())
+	payload := buildEndToEndPayload("custom", "5.0.0", encodedClientKey)
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), payload)
+	assert.NoError(t, err)
+	response := unmarshalResponse(res)
+	assert.Equal(t, endToEndAlgorithm, response.Encryption.Algorithm)
+	assert.NotEqual(t, "{\"custom\": \"5.0.0\"}", *response.Content)
+
+	// The client side of the protocol.
+	serverKeyBytes, _ := base64.StdEncoding.DecodeString(response.Encryption.ServerPublicKey)
+	serverKey, err := ecdh.X25519().NewPublicKey(serverKeyBytes)
+	assert.NoError(t, err)
+	sharedSecret, err := clientKey.ECDH(serverKey)
+	assert.NoError(t, err)
+	aead, err := newContentCipher(hkdfSha256(sharedSecret, append(clientKey.PublicKey().Bytes(), serverKeyBytes...), []byte(endToEndKeyInfo)))
+	assert.NoError(t, err)
+	nonce, _ := base64.StdEncoding.DecodeString(response.Encryption.Nonce)
+	ciphertext, _ := base64.StdEncoding.DecodeString(*response.Content)
+	content, err := aead.Open(nil, nonce, ciphertext, []byte("custom/5.0.0/"+*response.Hash))
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"custom\": \"5.0.0\"}", string(content))
+	assert.Equal(t, *response.Hash, strconv.FormatUint(uint64(crc32.ChecksumIEEE(content)), 10))
+}
+
+func TestThatClientKeyIsRequiredForEndToEndEncryptedType(t *testing.T) {
+	setConfigValue(t, endToEndEncryptionEnvVarName, `["custom"]`)
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "5.0.0", nil))
+	assert.EqualError(t, err, "`client_public_key` is required for `custom`")
+	assert.Equal(t, "{}", res)
+}
+
+func TestThatInvalidClientKeyIsRejected(t *testing.T) {
+	db, _ := createDbMock()
+	payload := buildEndToEndPayload("custom", "5.0.0", base64.StdEncoding.EncodeToString([]byte("short")))
+
+	_, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), payload)
+	assert.EqualError(t, err, "`client_public_key` must be an X25519 public key")
+}
+
+func TestThatHkdfMatchesRfc5869(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x0b}, 22)
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+
+	key := hkdfSha256(secret, salt, info)
+	assert.Equal(t, "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf", hex.EncodeToString(key))
+}
+
+func buildEndToEndPayload(typeName string, version string, clientKey string) string {
+	payload, err := json.Marshal(DownloaderRequest{Type: typeName, Version: version, ClientPublicKey: &clientKey})
+	if err != nil {
+		panic(err)
+	}
+	return string(payload[:])
+}
+
+func TestThatEndToEndEncryptionOfAnyTypeIsApplied(t *testing.T) {
+	setConfigValue(t, configFileEnvVarName, writeConfigFile(t, `
+types:
+  "*":
+    end_to_end_encryption: true
+    entitlement: {product_id: dlc}
+  core:
+    end_to_end_encryption: false
+`))
+	db, _ := createDbMock()
+
+	_, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "5.0.0", nil))
+	assert.EqualError(t, err, "`client_public_key` is required for `custom`")
+	_, err = RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("core", "1.0.0", nil))
+	assert.EqualError(t, err, "`core` requires a purchase")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const encryptionKeysEnvVarName string = "encryption_keys"
+
+/*
+The `encryption_keys` env var contains a JSON object where keys are types (`*` for types without their own key)
+and values are base64-encoded AES keys (16, 24 or 32 bytes), e.g. `{"events": "<base64 of 32 random bytes>"}`.
+
+Files of types with a key are stored encrypted with AES-GCM: a 12-byte nonce followed by the ciphertext and
+the tag. The type is used as additional authenticated data, so a file can't be moved to another type
+without re-encryption. Files are decrypted before hashing, so the hash is the hash of the plain content.
+*/
+func parseEncryptionKeys(value string) (map[string][]byte, error) {
+	var encodedKeys map[string]string
+	err := json.Unmarshal([]byte(value), &encodedKeys)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string][]byte, len(encodedKeys))
+	for typeName, encodedKey := range encodedKeys {
+		keys[typeName], err = decodeEncryptionKey(encodedKey)
+		if err != nil {
+			return nil, fmt.Errorf("`%s`: %w", typeName, err)
+		}
+	}
+	return keys, nil
+}
+
+func decodeEncryptionKey(encodedKey string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("key is not valid base64: %w", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("key must be 16, 24 or 32 bytes long")
+	}
+}
+
+func encryptionKeyFor(keys map[string][]byte, typeName string) ([]byte, bool) {
+	if key, ok := keys[typeName]; ok {
+		return key, true
+	}
+	key, ok := keys[anyTypeKey]
+	return key, ok
+}
+
+func decryptContent(key []byte, typeName string, content []byte) ([]byte, error) {
+	aead, err := newContentCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) < aead.NonceSize() {
+		return nil, errors.New("encrypted content is too short")
+	}
+	nonce, ciphertext := content[:aead.NonceSize()], content[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, []byte(typeName))
+}
+
+func encryptContent(key []byte, typeName string, content []byte) ([]byte, error) {
+	aead, err := newContentCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(content)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, content, []byte(typeName)), nil
+}
+
+func newContentCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"os"
+	"path/filepath"
+	mocks "pendyurinandrey.com/nakama-downloader-module/mocks/github.com/heroiclabs/nakama-common/runtime"
+	"testing"
+)
+
+var testEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestThatEncryptedFileIsDecryptedBeforeHashing(t *testing.T) {
+	root := t.TempDir()
+	encrypted, err := encryptContent(testEncryptionKey, "custom", []byte("{\"custom\": \"5.0.0\"}"))
+	assert.NoError(t, err)
+	writeContentFile(t, root, "custom", "5.0.0", encrypted)
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	setConfigValue(t, encryptionKeysEnvVarName, `{"custom": "`+base64.StdEncoding.EncodeToString(testEncryptionKey)+`"}`)
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "5.0.0", nil))
+	assert.NoError(t, err)
+	response := unmarshalResponse(res)
+	// The same hash as for the plain file from test_data.
+	assert.Equal(t, "3181399843", *response.Hash)
+	assert.Equal(t, "{\"custom\": \"5.0.0\"}", *response.Content)
+}
+
+func TestThatFileEncryptedForAnotherTypeIsNotServed(t *testing.T) {
+	root := t.TempDir()
+	encrypted, err := encryptContent(testEncryptionKey, "core", []byte("{}"))
+	assert.NoError(t, err)
+	writeContentFile(t, root, "custom", "5.0.0", encrypted)
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	setConfigValue(t, encryptionKeysEnvVarName, `{"*": "`+base64.StdEncoding.EncodeToString(testEncryptionKey)+`"}`)
+	db, _ := createDbMock()
+	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule.On("MetricsTimerRecord", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	mockNakamaModule.On("MetricsCounterAdd", requestsMetricName, map[string]string{"outcome": outcomeError}, int64(1)).Return().Once()
+	mockNakamaModule.On("Event", mock.Anything, mock.Anything).Return(nil).Once()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, mockNakamaModule, buildPayload("custom", "5.0.0", nil))
+	assertErrorCode(t, err, internalErrorCode)
+	assert.Equal(t, "{}", res)
+}
+
+func TestThatKeyOfWrongLengthIsRejected(t *testing.T) {
+	_, err := loadConfig(testEnvWith(encryptionKeysEnvVarName, `{"custom": "`+base64.StdEncoding.EncodeToString([]byte("short"))+`"}`))
+	assert.EqualError(t, err, "wrong `encryption_keys`: `custom`: key must be 16, 24 or 32 bytes long")
+}
+
+func writeContentFile(t *testing.T, root string, typeName string, version string, content []byte) {
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, typeName), 0o700))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, typeName, version+".json"), content, 0o600))
+}
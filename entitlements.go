@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const entitlementsEnvVarName string = "entitlements"
+
+const purchasesPageSize = 100
+
+/*
+The `entitlements` env var declares paid types. It contains a JSON object where keys are types and values
+are requirements: a validated purchase of the product and/or a positive amount of the item in the wallet, e.g.
+
+	{"dlc_winter": {"product_id": "com.example.game.winter", "wallet_item": "winter_pass"}}
+
+If both are set, any of them is enough. Types which are not listed are free.
+*/
+type entitlement struct {
+	ProductId  string `json:"product_id,omitempty" yaml:"product_id"`
+	WalletItem string `json:"wallet_item,omitempty" yaml:"wallet_item"`
+}
+
+func parseEntitlements(value string) (map[string]entitlement, error) {
+	var entitlements map[string]entitlement
+	err := json.Unmarshal([]byte(value), &entitlements)
+	if err != nil {
+		return nil, err
+	}
+	for typeName, e := range entitlements {
+		if err = validateEntitlement(e); err != nil {
+			return nil, fmt.Errorf("`%s`: %w", typeName, err)
+		}
+	}
+	return entitlements, nil
+}
+
+func validateEntitlement(e entitlement) error {
+	if e.ProductId == "" && e.WalletItem == "" {
+		return fmt.Errorf("requires neither a product nor a wallet item")
+	}
+	return nil
+}
+
+// `*` is applied to types without their own requirements.
+func entitlementFor(entitlements map[string]entitlement, typeName string) (entitlement, bool) {
+	if e, ok := entitlements[typeName]; ok {
+		return e, true
+	}
+	e, ok := entitlements[anyTypeKey]
+	return e, ok
+}
+
+func checkEntitlement(ctx context.Context, nk runtime.NakamaModule, entitlements map[string]entitlement, typeName string) error {
+	required, ok := entitlementFor(entitlements, typeName)
+	if !ok {
+		return nil
+	}
+	userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userId == "" {
+		return runtime.NewError(fmt.Sprintf("`%s` requires a purchase", typeName), permissionDeniedCode)
+	}
+
+	if required.WalletItem != "" {
+		owned, err := ownsWalletItem(ctx, nk, userId, required.WalletItem)
+		if err != nil || owned {
+			return err
+		}
+	}
+	if required.ProductId != "" {
+		purchased, err := hasPurchased(ctx, nk, userId, required.ProductId)
+		if err != nil || purchased {
+			return err
+		}
+	}
+	return runtime.NewError(fmt.Sprintf("`%s` requires a purchase", typeName), permissionDeniedCode)
+}
+
+func ownsWalletItem(ctx context.Context, nk runtime.NakamaModule, userId string, item string) (bool, error) {
+	account, err := nk.AccountGetId(ctx, userId)
+	if err != nil {
+		return false, runtime.NewError("Unable to check entitlement", internalErrorCode)
+	}
+	if account.Wallet == "" {
+		return false, nil
+	}
+	var wallet map[string]int64
+	if err = json.Unmarshal([]byte(account.Wallet), &wallet); err != nil {
+		return false, nil
+	}
+	return wallet[item] > 0, nil
+}
+
+// Refunded purchases don't grant access.
+func hasPurchased(ctx context.Context, nk runtime.NakamaModule, userId string, productId string) (bool, error) {
+	cursor := ""
+	for {
+		purchases, err := nk.PurchasesList(ctx, userId, purchasesPageSize, cursor)
+		if err != nil {
+			return false, runtime.NewError("Unable to check entitlement", internalErrorCode)
+		}
+		for _, purchase := range purchases.ValidatedPurchases {
+			refunded := purchase.RefundTime != nil && purchase.RefundTime.Seconds > 0
+			if purchase.ProductId == productId && !refunded {
+				return true, nil
+			}
+		}
+		if purchases.Cursor == "" {
+			return false, nil
+		}
+		cursor = purchases.Cursor
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"testing"
+)
+
+func TestThatPaidTypeIsDeniedToAnonymousCaller(t *testing.T) {
+	setConfigValue(t, entitlementsEnvVarName, `{"custom": {"product_id": "dlc"}}`)
+	db, _ := createDbMock()
+
+	_, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "5.0.0", nil))
+	assert.EqualError(t, err, "`custom` requires a purchase")
+	assertErrorCode(t, err, permissionDeniedCode)
+}
+
+func TestThatPaidTypeIsServedAfterPurchase(t *testing.T) {
+	setConfigValue(t, entitlementsEnvVarName, `{"custom": {"product_id": "dlc"}}`)
+	db, _ := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+	mockNakamaModule.
+		On("PurchasesList", mock.Anything, "user-1", purchasesPageSize, "").
+		Return(&api.PurchaseList{
+			ValidatedPurchases: []*api.ValidatedPurchase{{ProductId: "coins"}},
+			Cursor:             "next",
+		}, nil).
+		Once()
+	mockNakamaModule.
+		On("PurchasesList", mock.Anything, "user-1", purchasesPageSize, "next").
+		Return(&api.PurchaseList{ValidatedPurchases: []*api.ValidatedPurchase{{ProductId: "dlc"}}}, nil).
+		Once()
+
+	_, err := RpcFileDownloader(userContext("user-1"), buildLoggerMock(), db, mockNakamaModule, buildPayload("custom", "5.0.0", nil))
+	assert.NoError(t, err)
+}
+
+func TestThatRefundedPurchaseDoesNotGrantAccess(t *testing.T) {
+	setConfigValue(t, entitlementsEnvVarName, `{"custom": {"product_id": "dlc"}}`)
+	db, _ := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+	mockNakamaModule.
+		On("PurchasesList", mock.Anything, "user-1", purchasesPageSize, "").
+		Return(&api.PurchaseList{
+			ValidatedPurchases: []*api.ValidatedPurchase{{ProductId: "dlc", RefundTime: timestamppb.Now()}},
+		}, nil).
+		Once()
+
+	_, err := RpcFileDownloader(userContext("user-1"), buildLoggerMock(), db, mockNakamaModule, buildPayload("custom", "5.0.0", nil))
+	assertErrorCode(t, err, permissionDeniedCode)
+}
+
+func TestThatPaidTypeIsServedToOwnerOfWalletItem(t *testing.T) {
+	setConfigValue(t, entitlementsEnvVarName, `{"custom": {"product_id": "dlc", "wallet_item": "pass"}}`)
+	db, _ := createDbMock()
+	mockNakamaModule := buildNakamaModuleMock(t)
+	mockNakamaModule.
+		On("AccountGetId", mock.Anything, "user-1").
+		Return(&api.Account{Wallet: `{"pass": 1}`}, nil).
+		Once()
+
+	_, err := RpcFileDownloader(userContext("user-1"), buildLoggerMock(), db, mockNakamaModule, buildPayload("custom", "5.0.0", nil))
+	assert.NoError(t, err)
+}
+
+func TestThatEntitlementOfAnyTypeIsApplied(t *testing.T) {
+	setConfigValue(t, entitlementsEnvVarName, `{"*": {"product_id": "dlc"}}`)
+	db, _ := createDbMock()
+
+	_, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "5.0.0", nil))
+	assert.EqualError(t, err, "`custom` requires a purchase")
+	assertErrorCode(t, err, permissionDeniedCode)
+}
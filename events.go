@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const downloadEventName = "file_download"
+
+/*
+Publishes an event for every download request, including failed ones, so it reaches the functions registered with `RegisterEvent`
+and any external analytics pipeline configured in Nakama. Events are processed asynchronously by Nakama,
+that's why an error here only means that the event queue is full and the request itself is not failed.
+*/
+func publishDownloadEvent(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, resp DownloaderResponse, outcome string) {
+	properties := map[string]string{
+		"type":    resp.Type,
+		"version": resp.Version,
+		"outcome": outcome,
+	}
+	if resp.Hash != nil {
+		properties["hash"] = *resp.Hash
+	}
+	// Shows who still uses deprecated versions before they are deleted.
+	if resp.Deprecated {
+		properties["deprecated"] = "true"
+	}
+	for property, ctxKey := range userEventProperties {
+		if value, ok := ctx.Value(ctxKey).(string); ok && value != "" {
+			properties[property] = value
+		}
+	}
+
+	err := nk.Event(ctx, &api.Event{
+		Name:       downloadEventName,
+		Properties: properties,
+		Timestamp:  timestamppb.Now(),
+		External:   false,
+	})
+	if err != nil {
+		logger.Warn("Failed to publish download event: %v", err)
+	}
+}
+
+var userEventProperties = map[string]string{
+	"user_id":    runtime.RUNTIME_CTX_USER_ID,
+	"username":   runtime.RUNTIME_CTX_USERNAME,
+	"session_id": runtime.RUNTIME_CTX_SESSION_ID,
+	"lang":       runtime.RUNTIME_CTX_LANG,
+}
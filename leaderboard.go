@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const popularContentLeaderboardPrefix = "popular_content_"
+
+/*
+Leaderboard records must be owned by a UUID, while the downloaded content is identified by type and version.
+The owner ID is derived from them as a name-based UUID (version 5), so the same version always maps to the same record.
+*/
+var popularContentNamespace = [16]byte{
+	0x5d, 0x3b, 0x8e, 0x6a, 0x2f, 0x41, 0x4c, 0x1e, 0x9b, 0x0a, 0x77, 0xd2, 0x3c, 0x58, 0xe1, 0x04,
+}
+
+func popularContentLeaderboardId(typeName string) string {
+	return popularContentLeaderboardPrefix + typeName
+}
+
+/*
+Creates a leaderboard per content type found in the content roots. Each record of the leaderboard is a version
+of the type, and its score is the number of downloads, so the standard leaderboard APIs can be used to list
+the most downloaded versions (e.g. user-generated levels).
+*/
+func createPopularContentLeaderboards(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, cfg *moduleConfig) error {
+	types, err := listAllContentTypes(cfg)
+	if err != nil {
+		// Content can be mounted later, the leaderboards of the missing types are created on the next reload or publication.
+		logger.Warn("Unable to list content types, popular content leaderboards are not created: %v", err)
+		return nil
+	}
+	for _, typeName := range types {
+		err = createPopularContentLeaderboard(ctx, nk, typeName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Creation of an existing leaderboard is a no-op in Nakama, so it's safe to call it on every startup, reload and publication.
+func createPopularContentLeaderboard(ctx context.Context, nk runtime.NakamaModule, typeName string) error {
+	return nk.LeaderboardCreate(ctx, popularContentLeaderboardId(typeName), true, "desc", "incr", "", map[string]interface{}{"type": typeName})
+}
+
+func incrementPopularContent(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, resp DownloaderResponse) {
+	if resp.Content == nil {
+		// The same rule as for statistics: only downloads of the content are counted.
+		return
+	}
+	operator := int(api.Operator_INCREMENT)
+	metadata := map[string]interface{}{"type": resp.Type, "version": resp.Version}
+	_, err := nk.LeaderboardRecordWrite(ctx, popularContentLeaderboardId(resp.Type), contentOwnerId(resp.Type, resp.Version),
+		resp.Version, 1, 0, metadata, &operator)
+	if err != nil {
+		logger.Warn("Failed to update popular content leaderboard: %v", err)
+	}
+}
+
+func contentOwnerId(typeName string, version string) string {
+	h := sha1.New()
+	h.Write(popularContentNamespace[:])
+	h.Write([]byte(typeName + "/" + version))
+	var id [16]byte
+	copy(id[:], h.Sum(nil))
+	id[6] = (id[6] & 0x0f) | 0x50
+	id[8] = (id[8] & 0x3f) | 0x80
+
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], id[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], id[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], id[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], id[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], id[10:])
+	return string(buf)
+}
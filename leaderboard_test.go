@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	mocks "pendyurinandrey.com/nakama-downloader-module/mocks/github.com/heroiclabs/nakama-common/runtime"
+	"testing"
+)
+
+func TestThatLeaderboardIsCreatedForEveryContentType(t *testing.T) {
+	mockLogger := buildLoggerMock()
+	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	for _, typeName := range []string{"core", "custom"} {
+		mockNakamaModule.
+			On("LeaderboardCreate", mock.Anything, "popular_content_"+typeName, true, "desc", "incr", "", map[string]interface{}{"type": typeName}).
+			Return(nil).
+			Once()
+	}
+
+	err := createPopularContentLeaderboards(context.Background(), mockLogger, mockNakamaModule, currentConfig())
+	assert.NoError(t, err)
+}
+
+func TestThatDownloadIncrementsLeaderboardRecordOfVersion(t *testing.T) {
+	db, _ := createDbMock()
+	mockLogger := buildLoggerMock()
+	mockNakamaModule := mocks.NewNakamaModuleMock(t)
+	mockNakamaModule.On("MetricsCounterAdd", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	mockNakamaModule.On("MetricsTimerRecord", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	mockNakamaModule.On("Event", mock.Anything, mock.Anything).Return(nil).Maybe()
+	increment := int(api.Operator_INCREMENT)
+	mockNakamaModule.
+		On("LeaderboardRecordWrite", mock.Anything, "popular_content_custom", contentOwnerId("custom", "5.0.0"), "5.0.0",
+			int64(1), int64(0), map[string]interface{}{"type": "custom", "version": "5.0.0"}, &increment).
+		Return(&api.LeaderboardRecord{}, nil).
+		Once()
+
+	_, err := RpcFileDownloader(context.Background(), mockLogger, db, mockNakamaModule, buildPayload("custom", "5.0.0", nil))
+	assert.NoError(t, err)
+}
+
+func TestThatContentOwnerIdIsStableUuid(t *testing.T) {
+	id := contentOwnerId("custom", "5.0.0")
+	assert.Regexp(t, "^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", id)
+	assert.Equal(t, id, contentOwnerId("custom", "5.0.0"))
+	assert.NotEqual(t, id, contentOwnerId("custom", "5.0.1"))
+}
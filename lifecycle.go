@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"os"
+	"strings"
+)
+
+type DeprecationRequest struct {
+	Type    string `json:"type"`
+	Version string `json:"version"`
+	// Defaults to true, false reverts the deprecation.
+	Deprecated  *bool   `json:"deprecated,omitempty"`
+	Replacement *string `json:"replacement,omitempty"`
+	Reason      string  `json:"reason"`
+}
+
+type DeletionRequest struct {
+	Type        string  `json:"type"`
+	Version     string  `json:"version"`
+	Replacement *string `json:"replacement,omitempty"`
+	Reason      string  `json:"reason"`
+}
+
+/*
+The removed version is reported with FAILED_PRECONDITION rather than NOT_FOUND, so clients can tell
+a retired version from a typo and switch to the replacement instead of retrying.
+*/
+func removedError(typeName string, version string, replacement string) error {
+	message := fmt.Sprintf("Version `%s` of `%s` was removed", version, typeName)
+	if replacement != "" {
+		message += fmt.Sprintf(", use `%s` instead", replacement)
+	}
+	return runtime.NewError(message, failedPreconditionCode)
+}
+
+func validateReplacement(version string, replacement *string) error {
+	if replacement == nil {
+		return nil
+	}
+	err := validateName("replacement", *replacement)
+	if err != nil {
+		return err
+	}
+	if *replacement == version {
+		return runtime.NewError("`replacement` must differ from `version`", invalidArgumentCode)
+	}
+	return nil
+}
+
+// Marks a version as deprecated: it's still served, but responses are flagged and point to the replacement.
+func RpcDownloaderDeprecate(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	err := checkServerToServer(ctx)
+	if err != nil {
+		return "{}", err
+	}
+	var req DeprecationRequest
+	err = json.Unmarshal([]byte(payload), &req)
+	if err != nil {
+		logger.Info("Unable to deserialize request %v", err)
+		return "{}", runtime.NewError("Unable to deserialize request", invalidArgumentCode)
+	}
+	err = validateRequest(DownloaderRequest{Type: req.Type, Version: req.Version})
+	if err != nil {
+		return "{}", err
+	}
+	err = validateReplacement(req.Version, req.Replacement)
+	if err != nil {
+		return "{}", err
+	}
+	deprecated := req.Deprecated == nil || *req.Deprecated
+	operation := "deprecate"
+	if !deprecated {
+		operation = "undeprecate"
+		req.Replacement = nil
+	}
+	// The replacement of a removed version is a part of its tombstone, so it must not be changed.
+	metadata, err := versionMetadataFor(ctx, logger, db, req.Type, req.Version)
+	if err != nil {
+		return "{}", err
+	}
+	if metadata.RemovedAt != nil {
+		return "{}", removedError(req.Type, req.Version, metadata.Replacement)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to deprecate content: %v", err)
+		return "{}", runtime.NewError("Unable to deprecate content", internalErrorCode)
+	}
+	// The metadata may be stale, the condition protects tombstones created by other nodes in the meantime.
+	result, err := tx.ExecContext(ctx, `
+		insert into downloader_content_versions(type, version, deprecated, replacement)
+		values($1, $2, $3, $4)
+		on conflict(type, version) do update
+		    set deprecated = excluded.deprecated,
+		        replacement = excluded.replacement,
+		        updated_at = now()
+		    where downloader_content_versions.removed_at is null
+	`, req.Type, req.Version, deprecated, req.Replacement)
+	var updated int64
+	if err == nil {
+		updated, err = result.RowsAffected()
+	}
+	if err == nil && updated == 0 {
+		_ = tx.Rollback()
+		return "{}", removedError(req.Type, req.Version, metadata.Replacement)
+	}
+	if err == nil {
+		err = writeAuditRecord(ctx, tx, auditRecord{
+			Actor: auditActor(ctx), Operation: operation, Type: req.Type, Version: req.Version, Reason: req.Reason,
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		_ = tx.Rollback()
+	}
+	if err != nil {
+		logger.Error("Failed to deprecate content: %v", err)
+		return "{}", runtime.NewError("Unable to deprecate content", internalErrorCode)
+	}
+	contentMetadata.invalidate()
+	if err = syncCatalogType(ctx, logger, db, nk, currentConfig(), req.Type); err != nil {
+		logger.Warn("Failed to update the content catalog: %v", err)
+	}
+	return "{}", nil
+}
+
+/*
+Deletes the file of a version and leaves a tombstone in the `downloader_content_versions` table. The tombstone
+is never removed by the module, so the version can't be published again: clients which cached the old content
+by its version would not notice the change otherwise.
+*/
+func RpcDownloaderDelete(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	err := checkServerToServer(ctx)
+	if err != nil {
+		return "{}", err
+	}
+	var req DeletionRequest
+	err = json.Unmarshal([]byte(payload), &req)
+	if err != nil {
+		logger.Info("Unable to deserialize request %v", err)
+		return "{}", runtime.NewError("Unable to deserialize request", invalidArgumentCode)
+	}
+	err = validateRequest(DownloaderRequest{Type: req.Type, Version: req.Version})
+	if err != nil {
+		return "{}", err
+	}
+	err = validateReplacement(req.Version, req.Replacement)
+	if err != nil {
+		return "{}", err
+	}
+	metadata, err := versionMetadataFor(ctx, logger, db, req.Type, req.Version)
+	if err != nil {
+		return "{}", err
+	}
+	if metadata.RemovedAt != nil {
+		return "{}", removedError(req.Type, req.Version, metadata.Replacement)
+	}
+
+	cfg := currentConfig()
+	filePath, err := buildFilePath(cfg, req.Type, req.Version)
+	if err != nil {
+		return "{}", err
+	}
+	key, encrypted := encryptionKeyFor(cfg.EncryptionKeys, req.Type)
+	oldHash, err := readContentHash(filePath, req.Type, key, encrypted)
+	if os.IsNotExist(err) {
+		return "{}", runtime.NewError(fmt.Sprintf("File not found on path: %s", filePath), notFoundCode)
+	}
+	if err != nil {
+		// The file is deleted anyway, the audit record just doesn't contain its hash.
+		logger.Warn("Unable to read the version %s before deletion: %v", filePath, err)
+	}
+	// The version is deleted from all roots, otherwise a shadowed copy would be served after a restore.
+	paths := existingContentFilePaths(cfg, req.Type, req.Version)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to delete content: %v", err)
+		return "{}", runtime.NewError("Unable to delete content", internalErrorCode)
+	}
+	_, err = tx.ExecContext(ctx, `
+		insert into downloader_content_versions(type, version, replacement, removed_at)
+		values($1, $2, $3, now())
+		on conflict(type, version) do update
+		    set replacement = coalesce(excluded.replacement, downloader_content_versions.replacement),
+		        removed_at = excluded.removed_at,
+		        updated_at = now()
+	`, req.Type, req.Version, req.Replacement)
+	if err == nil {
+		err = writeAuditRecord(ctx, tx, auditRecord{
+			Actor: auditActor(ctx), Operation: "delete", Type: req.Type, Version: req.Version, OldHash: oldHash, Reason: req.Reason,
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		_ = tx.Rollback()
+	}
+	if err != nil {
+		logger.Error("Failed to delete content: %v", err)
+		return "{}", runtime.NewError("Unable to delete content", internalErrorCode)
+	}
+	contentMetadata.invalidate()
+	quarantinedContent.release(req.Type, req.Version)
+	recordQuarantinedVersions(nk)
+
+	/*
+		Files are deleted after the tombstone is committed, so a failure of the database doesn't leave a missing file
+		without a tombstone. Files which can't be removed are not served anyway, they are reported to be removed manually.
+	*/
+	var remaining []string
+	for _, path := range paths {
+		if err = os.Remove(path); err != nil {
+			logger.Error("Unable to remove %s of a deleted version: %v", path, err)
+			remaining = append(remaining, path)
+		}
+	}
+	if err = syncCatalogType(ctx, logger, db, nk, cfg, req.Type); err != nil {
+		logger.Warn("Failed to update the content catalog: %v", err)
+	}
+	if len(remaining) > 0 {
+		return "{}", runtime.NewError(fmt.Sprintf("Version `%s` of `%s` is deleted, but some of its files can't be removed: %s",
+			req.Version, req.Type, strings.Join(remaining, ", ")), internalErrorCode)
+	}
+	return "{}", nil
+}
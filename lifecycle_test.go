@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestThatDeprecatedVersionIsServedWithReplacement(t *testing.T) {
+	useContentMetadata(t, map[contentKey]versionMetadata{{Type: "custom", Version: "5.0.0"}: {Deprecated: true, Replacement: "6.0.0"}})
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "5.0.0", nil))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "custom", "version": "5.0.0", "hash": "3181399843", "content": "{\"custom\": \"5.0.0\"}",
+		"deprecated": true, "replacement": "6.0.0"
+	}`, res)
+}
+
+func TestThatRemovedVersionIsReportedDifferentlyFromMissingOne(t *testing.T) {
+	removedAt := time.Now().Add(-time.Hour)
+	useContentMetadata(t, map[contentKey]versionMetadata{{Type: "custom", Version: "5.0.0"}: {RemovedAt: &removedAt, Replacement: "6.0.0"}})
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "5.0.0", nil))
+	assertErrorCode(t, err, failedPreconditionCode)
+	assert.EqualError(t, err, "Version `5.0.0` of `custom` was removed, use `6.0.0` instead")
+	assert.Equal(t, "{}", res)
+	res, err = RpcFileList(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom"}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"types": [{"type": "custom", "versions": []}]}`, res)
+}
+
+func TestThatDeprecationIsStoredWithAuditRecord(t *testing.T) {
+	useContentMetadata(t, map[contentKey]versionMetadata{})
+	db, dbMock := createDbMock()
+	replacement := "2.0.0"
+	dbMock.ExpectBegin()
+	dbMock.
+		ExpectExec("insert into downloader_content_versions").
+		WithArgs("core", "1.0.0", true, &replacement).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.
+		ExpectExec("insert into downloader_audit_log").
+		WithArgs("server", "deprecate", "core", "1.0.0", nil, nil, "retired").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+
+	res, err := RpcDownloaderDeprecate(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "core", "version": "1.0.0", "replacement": "2.0.0", "reason": "retired"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", res)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatRemovedVersionCantBeDeprecated(t *testing.T) {
+	removedAt := time.Now().Add(-time.Hour)
+	useContentMetadata(t, map[contentKey]versionMetadata{{Type: "custom", Version: "5.0.0"}: {RemovedAt: &removedAt, Replacement: "6.0.0"}})
+	db, dbMock := createDbMock()
+
+	for _, payload := range []string{
+		`{"type": "custom", "version": "5.0.0", "replacement": "7.0.0"}`,
+		`{"type": "custom", "version": "5.0.0", "deprecated": false}`,
+	} {
+		_, err := RpcDownloaderDeprecate(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), payload)
+		assertErrorCode(t, err, failedPreconditionCode)
+	}
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatVersionRemovedByAnotherNodeIsNotDeprecated(t *testing.T) {
+	useContentMetadata(t, map[contentKey]versionMetadata{})
+	db, dbMock := createDbMock()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("where downloader_content_versions.removed_at is null").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectRollback()
+
+	_, err := RpcDownloaderDeprecate(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "custom", "version": "5.0.0"}`)
+	assertErrorCode(t, err, failedPreconditionCode)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatVersionCantBeReplacedByItself(t *testing.T) {
+	db, _ := createDbMock()
+
+	_, err := RpcDownloaderDeprecate(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "core", "version": "1.0.0", "replacement": "1.0.0"}`)
+	assertErrorCode(t, err, invalidArgumentCode)
+}
+
+func TestThatDeletionRemovesFileAndLeavesTombstone(t *testing.T) {
+	useContentMetadata(t, map[contentKey]versionMetadata{})
+	root := t.TempDir()
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	writeContentFile(t, root, "custom", "5.0.0", []byte(`{"custom": "5.0.0"}`))
+	db, dbMock := createDbMock()
+	oldHash := "3181399843"
+	dbMock.ExpectBegin()
+	dbMock.
+		ExpectExec("insert into downloader_content_versions").
+		WithArgs("custom", "5.0.0", nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.
+		ExpectExec("insert into downloader_audit_log").
+		WithArgs("server", "delete", "custom", "5.0.0", &oldHash, nil, "obsolete").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+
+	_, err := RpcDownloaderDelete(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "custom", "version": "5.0.0", "reason": "obsolete"}`)
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(root, "custom", "5.0.0.json"))
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatFileIsKeptIfTombstoneFails(t *testing.T) {
+	useContentMetadata(t, map[contentKey]versionMetadata{})
+	root := t.TempDir()
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	writeContentFile(t, root, "custom", "5.0.0", []byte(`{"custom": "5.0.0"}`))
+	db, dbMock := createDbMock()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("insert into downloader_content_versions").WillReturnError(assert.AnError)
+	dbMock.ExpectRollback()
+
+	_, err := RpcDownloaderDelete(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "custom", "version": "5.0.0"}`)
+	assertErrorCode(t, err, internalErrorCode)
+	_, err = os.Stat(filepath.Join(root, "custom", "5.0.0.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatMissingVersionCantBeDeleted(t *testing.T) {
+	db, _ := createDbMock()
+
+	_, err := RpcDownloaderDelete(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "custom", "version": "9.0.0"}`)
+	assertErrorCode(t, err, notFoundCode)
+}
+
+func TestThatRemovedVersionCantBePublishedAgain(t *testing.T) {
+	removedAt := time.Now().Add(-time.Hour)
+	useContentMetadata(t, map[contentKey]versionMetadata{{Type: "custom", Version: "5.0.0"}: {RemovedAt: &removedAt}})
+	db, _ := createDbMock()
+
+	_, err := RpcDownloaderPublish(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "custom", "version": "5.0.0", "content": "{}", "overwrite": true}`)
+	assertErrorCode(t, err, failedPreconditionCode)
+}
+
+func TestThatLifecycleIsNotAvailableToUsers(t *testing.T) {
+	db, _ := createDbMock()
+
+	_, err := RpcDownloaderDeprecate(userContext("user-1"), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "core", "version": "1.0.0"}`)
+	assertErrorCode(t, err, permissionDeniedCode)
+	_, err = RpcDownloaderDelete(userContext("user-1"), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "core", "version": "1.0.0"}`)
+	assertErrorCode(t, err, permissionDeniedCode)
+}
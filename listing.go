@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type ListRequest struct {
+	Type *string `json:"type,omitempty"`
+}
+
+type ListResponse struct {
+	Types []ListedType `json:"types"`
+}
+
+type ListedType struct {
+	Type     string   `json:"type"`
+	Versions []string `json:"versions"`
+	// Names of the roots which serve the versions, keyed by versions. It's set only if there are several roots.
+	Sources map[string]string `json:"sources,omitempty"`
+}
+
+/*
+Lists available types and their versions. Types which the caller is not allowed to download are omitted,
+unless a specific type is requested: in this case the same error as for the download is returned.
+*/
+func RpcFileList(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req ListRequest
+	if strings.TrimSpace(payload) != "" {
+		err := json.Unmarshal([]byte(payload), &req)
+		if err != nil {
+			logger.Info("Unable to deserialize request %v", err)
+			return "{}", runtime.NewError("Unable to deserialize request", invalidArgumentCode)
+		}
+	}
+
+	cfg := currentConfig()
+	rules := cfg.AccessRules
+
+	var types []string
+	var err error
+	if req.Type != nil {
+		err = validateName("type", *req.Type)
+		if err != nil {
+			return "{}", err
+		}
+		err = checkAccess(ctx, nk, rules, *req.Type)
+		if err != nil {
+			return "{}", err
+		}
+		types = []string{*req.Type}
+	} else {
+		types, err = listAllContentTypes(cfg)
+		if err != nil {
+			logger.Error("Unable to list content types: %v", err)
+			return "{}", runtime.NewError("Unable to list content", internalErrorCode)
+		}
+	}
+
+	resp := ListResponse{Types: []ListedType{}}
+	for _, typeName := range types {
+		if req.Type == nil {
+			allowed, err := isAccessAllowed(ctx, nk, accessRuleFor(rules, typeName))
+			if err != nil {
+				return "{}", err
+			}
+			if !allowed {
+				continue
+			}
+		}
+		versions, sources, err := listAllContentVersions(cfg, typeName)
+		if err != nil {
+			if req.Type != nil && os.IsNotExist(err) {
+				return "{}", runtime.NewError("Type not found", notFoundCode)
+			}
+			logger.Error("Unable to list versions of %s: %v", typeName, err)
+			return "{}", runtime.NewError("Unable to list content", internalErrorCode)
+		}
+		versions, err = filterAvailableVersions(ctx, logger, db, nk, typeName, versions)
+		if err != nil {
+			return "{}", err
+		}
+		listed := ListedType{Type: typeName, Versions: versions}
+		if len(cfg.Roots) > 1 {
+			listed.Sources = make(map[string]string, len(versions))
+			for _, version := range versions {
+				listed.Sources[version] = sources[version]
+			}
+		}
+		resp.Types = append(resp.Types, listed)
+	}
+
+	respStr, err := json.Marshal(resp)
+	if err != nil {
+		return "{}", err
+	}
+	return string(respStr[:]), nil
+}
+
+func filterAvailableVersions(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, typeName string, versions []string) ([]string, error) {
+	available := make([]string, 0, len(versions))
+	for _, version := range versions {
+		if quarantinedContent.contains(typeName, version) {
+			continue
+		}
+		ok, err := checkVersionAvailable(ctx, logger, db, nk, typeName, version)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			available = append(available, version)
+		}
+	}
+	return available, nil
+}
+
+func listContentVersions(cfg *moduleConfig, root string, typeName string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(root, typeName))
+	if err != nil {
+		return nil, err
+	}
+	extension := extensionFor(cfg.Extensions, typeName)
+	versions := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, extension) {
+			continue
+		}
+		version := strings.TrimSuffix(name, extension)
+		if validateName("version", version) != nil {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
@@ -7,29 +7,93 @@ import (
 )
 
 func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
-	err := createScheme(ctx, db)
+	env, _ := ctx.Value(runtime.RUNTIME_CTX_ENV).(map[string]string)
+	cfg, err := loadConfig(env)
 	if err != nil {
-		logger.Error("Failed to create DB scheme: %e", err)
+		logger.Error("Failed to load configuration: %e", err)
 		return err
 	}
+	activeConfig.Store(cfg)
+	err = migrateSchema(ctx, db, cfg)
+	if err != nil {
+		logger.Error("Failed to migrate DB scheme: %e", err)
+		return err
+	}
+	err = createPopularContentLeaderboards(ctx, logger, nk, cfg)
+	if err != nil {
+		logger.Error("Failed to create popular content leaderboards: %e", err)
+		return err
+	}
+	_, err = sweepContent(logger, nk, cfg)
+	if err != nil {
+		// Content can be mounted later, it's validated by the DownloaderValidateContent rpc then.
+		logger.Warn("Unable to validate content: %v", err)
+	}
+	err = syncCatalog(ctx, logger, db, nk, cfg)
+	if err != nil {
+		// The catalog is only a mirror for the console, it's updated again on the next publication or reload.
+		logger.Warn("Failed to update the content catalog: %v", err)
+	}
 	err = initializer.RegisterRpc("FileDownloader", RpcFileDownloader)
 	if err != nil {
 		logger.Error("Failed to register the downloader rpc: %e", err)
 		return err
 	}
+	err = initializer.RegisterRpc("FileList", RpcFileList)
+	if err != nil {
+		logger.Error("Failed to register the list rpc: %e", err)
+		return err
+	}
+	err = initializer.RegisterRpc("FileDownloadToken", RpcFileDownloadToken)
+	if err != nil {
+		logger.Error("Failed to register the download token rpc: %e", err)
+		return err
+	}
+	err = initializer.RegisterRpc("DownloaderAuditLog", RpcDownloaderAuditLog)
+	if err != nil {
+		logger.Error("Failed to register the audit log rpc: %e", err)
+		return err
+	}
+	err = initializer.RegisterRpc("DownloaderSetAvailability", RpcDownloaderSetAvailability)
+	if err != nil {
+		logger.Error("Failed to register the availability rpc: %e", err)
+		return err
+	}
+	err = initializer.RegisterRpc("DownloaderPublish", RpcDownloaderPublish)
+	if err != nil {
+		logger.Error("Failed to register the publish rpc: %e", err)
+		return err
+	}
+	err = initializer.RegisterRpc("DownloaderValidateContent", RpcDownloaderValidateContent)
+	if err != nil {
+		logger.Error("Failed to register the content validation rpc: %e", err)
+		return err
+	}
+	err = initializer.RegisterRpc("DownloaderDeprecate", RpcDownloaderDeprecate)
+	if err != nil {
+		logger.Error("Failed to register the deprecation rpc: %e", err)
+		return err
+	}
+	err = initializer.RegisterRpc("DownloaderDelete", RpcDownloaderDelete)
+	if err != nil {
+		logger.Error("Failed to register the deletion rpc: %e", err)
+		return err
+	}
+	err = initializer.RegisterRpc("DownloaderSetAlias", RpcDownloaderSetAlias)
+	if err != nil {
+		logger.Error("Failed to register the alias rpc: %e", err)
+		return err
+	}
+	err = initializer.RegisterRpc("DownloaderPromote", RpcDownloaderPromote)
+	if err != nil {
+		logger.Error("Failed to register the promote rpc: %e", err)
+		return err
+	}
+	err = initializer.RegisterRpc("DownloaderReloadConfig", RpcDownloaderReloadConfig)
+	if err != nil {
+		logger.Error("Failed to register the config reload rpc: %e", err)
+		return err
+	}
 
 	return nil
 }
-
-func createScheme(ctx context.Context, db *sql.DB) error {
-	_, err := db.ExecContext(ctx, createTableQuery)
-	return err
-}
-
-const createTableQuery = `
-	CREATE TABLE IF NOT EXISTS download_statistics (
-	    file_name varchar(256) not null,
-	    file_hash varchar(256) not null,
-	    download_count bigint default 0,
-	    primary key(file_name, file_hash)
-	)`
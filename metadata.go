@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+/*
+Metadata of versions is read on every download, so it's cached. The whole table is loaded at once: it contains
+only versions with non-default settings, so it's small. Changes made on this node are visible immediately,
+changes made on other nodes of the cluster become visible after the TTL.
+*/
+const contentMetadataTtl = 5 * time.Second
+
+type contentKey struct {
+	Type    string
+	Version string
+}
+
+type versionMetadata struct {
+	AvailableFrom  *time.Time
+	AvailableUntil *time.Time
+	// A cron expression and the duration of every window for recurring content, e.g. weekend events.
+	Schedule         string
+	ScheduleDuration time.Duration
+	// Deprecated versions are still served, clients are advised to switch to the replacement.
+	Deprecated  bool
+	Replacement string
+	// A tombstone of a deleted version, it's reported with a specific error instead of not found.
+	RemovedAt *time.Time
+}
+
+type contentMetadataSnapshot struct {
+	versions map[contentKey]versionMetadata
+	// Versions which aliases point to, the key contains the name of the alias instead of a version.
+	aliases   map[contentKey]string
+	expiresAt time.Time
+}
+
+type contentMetadataCache struct {
+	mu       sync.Mutex
+	snapshot *contentMetadataSnapshot
+}
+
+var contentMetadata = &contentMetadataCache{}
+
+func (s *contentMetadataSnapshot) version(typeName string, version string) versionMetadata {
+	return s.versions[contentKey{Type: typeName, Version: version}]
+}
+
+func (s *contentMetadataSnapshot) alias(typeName string, alias string) (string, bool) {
+	version, ok := s.aliases[contentKey{Type: typeName, Version: alias}]
+	return version, ok
+}
+
+/*
+If the table can't be read, the previous snapshot is returned together with the error, so a short outage of
+the database doesn't make all content unavailable. Without any snapshot the caller has to fail the request,
+otherwise content which is not published yet could be served.
+*/
+func (c *contentMetadataCache) get(ctx context.Context, db *sql.DB) (*contentMetadataSnapshot, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.snapshot != nil && now.Before(c.snapshot.expiresAt) {
+		return c.snapshot, nil
+	}
+	versions, err := loadVersionMetadata(ctx, db)
+	if err != nil {
+		return c.snapshot, err
+	}
+	aliases, err := loadAliases(ctx, db)
+	if err != nil {
+		return c.snapshot, err
+	}
+	c.snapshot = &contentMetadataSnapshot{versions: versions, aliases: aliases, expiresAt: now.Add(contentMetadataTtl)}
+	return c.snapshot, nil
+}
+
+func (c *contentMetadataCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.snapshot != nil {
+		c.snapshot.expiresAt = time.Time{}
+	}
+}
+
+func (c *contentMetadataCache) store(snapshot *contentMetadataSnapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.snapshot = snapshot
+}
+
+func loadVersionMetadata(ctx context.Context, db *sql.DB) (map[contentKey]versionMetadata, error) {
+	rows, err := db.QueryContext(ctx, `
+		select type, version, available_from, available_until, schedule, schedule_duration, deprecated, replacement, removed_at
+		from downloader_content_versions
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[contentKey]versionMetadata)
+	for rows.Next() {
+		var key contentKey
+		var metadata versionMetadata
+		var availableFrom, availableUntil sql.NullTime
+		var schedule sql.NullString
+		var scheduleDuration sql.NullInt64
+		var replacement sql.NullString
+		var removedAt sql.NullTime
+		err = rows.Scan(&key.Type, &key.Version, &availableFrom, &availableUntil, &schedule, &scheduleDuration,
+			&metadata.Deprecated, &replacement, &removedAt)
+		if err != nil {
+			return nil, err
+		}
+		if availableFrom.Valid {
+			metadata.AvailableFrom = &availableFrom.Time
+		}
+		if availableUntil.Valid {
+			metadata.AvailableUntil = &availableUntil.Time
+		}
+		metadata.Schedule = schedule.String
+		metadata.ScheduleDuration = time.Duration(scheduleDuration.Int64) * time.Second
+		metadata.Replacement = replacement.String
+		if removedAt.Valid {
+			metadata.RemovedAt = &removedAt.Time
+		}
+		versions[key] = metadata
+	}
+	return versions, rows.Err()
+}
+
+func loadAliases(ctx context.Context, db *sql.DB) (map[contentKey]string, error) {
+	rows, err := db.QueryContext(ctx, `select type, alias, version from downloader_content_aliases`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := make(map[contentKey]string)
+	for rows.Next() {
+		var key contentKey
+		var version string
+		err = rows.Scan(&key.Type, &key.Version, &version)
+		if err != nil {
+			return nil, err
+		}
+		aliases[key] = version
+	}
+	return aliases, rows.Err()
+}
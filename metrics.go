@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/heroiclabs/nakama-common/runtime"
+	"time"
+)
+
+/*
+Metrics are emitted through the Nakama metrics API, so they are exported by the Prometheus endpoint
+of the server together with Nakama's own metrics.
+*/
+const requestsMetricName = "downloader_requests"
+const bytesServedMetricName = "downloader_bytes_served"
+const fileReadLatencyMetricName = "downloader_file_read_latency"
+const hashingLatencyMetricName = "downloader_hashing_latency"
+const statisticsWriteFailuresMetricName = "downloader_statistics_write_failures"
+const quarantinedVersionsMetricName = "downloader_quarantined_versions"
+
+const outcomeServed = "served"
+
+// The hash from the request doesn't match the file, the response contains no content.
+const outcomeHashMismatch = "hash_mismatch"
+const outcomeNotFound = "not_found"
+const outcomeInvalid = "invalid"
+const outcomeDenied = "denied"
+const outcomeRateLimited = "rate_limited"
+const outcomeTooLarge = "too_large"
+const outcomeQuarantined = "quarantined"
+const outcomeRemoved = "removed"
+
+// The request is valid, but it can't be processed because of a server-side problem, e.g. an unavailable DB.
+const outcomeError = "error"
+
+/*
+Outcomes of requests for existing files. Other requests may contain any valid names, e.g. a client looping over
+random versions, so they are tagged only by the outcome to keep the number of series bounded.
+*/
+var resolvedOutcomes = map[string]bool{
+	outcomeServed:       true,
+	outcomeHashMismatch: true,
+	outcomeTooLarge:     true,
+	outcomeQuarantined:  true,
+}
+
+func recordOutcome(nk runtime.NakamaModule, req DownloaderRequest, outcome string) {
+	tags := map[string]string{"outcome": outcome}
+	if resolvedOutcomes[outcome] {
+		tags["type"] = req.Type
+		tags["version"] = req.Version
+	}
+	nk.MetricsCounterAdd(requestsMetricName, tags, 1)
+}
+
+func recordBytesServed(nk runtime.NakamaModule, resp DownloaderResponse) {
+	if resp.Content == nil {
+		return
+	}
+	tags := map[string]string{"type": resp.Type, "version": resp.Version}
+	nk.MetricsCounterAdd(bytesServedMetricName, tags, int64(len(*resp.Content)))
+}
+
+func recordLatency(nk runtime.NakamaModule, name string, typeName string, startedAt time.Time) {
+	nk.MetricsTimerRecord(name, map[string]string{"type": typeName}, time.Since(startedAt))
+}
+
+func recordStatisticsWriteFailure(nk runtime.NakamaModule) {
+	nk.MetricsCounterAdd(statisticsWriteFailuresMetricName, map[string]string{}, 1)
+}
+
+// Every node sweeps its own content, so the gauge is reported per node.
+func recordQuarantinedVersions(nk runtime.NakamaModule) {
+	nk.MetricsGaugeSet(quarantinedVersionsMetricName, map[string]string{}, float64(quarantinedContent.count()))
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+const schemaVersionEnvVarName string = "schema_version"
+
+/*
+An arbitrary key for pg_advisory_xact_lock. All Nakama nodes running the module use the same key,
+so only one of them applies migrations at a time, the others wait and then find nothing to apply.
+*/
+const migrationsLockKey int64 = 7_310_842_215
+
+type migrationStep func(ctx context.Context, tx *sql.Tx) error
+
+type migration struct {
+	version int
+	name    string
+	up      migrationStep
+	down    migrationStep
+}
+
+/*
+Migrations are applied in the order of their versions. A version must never be changed or reused once released,
+add a new migration instead.
+*/
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create_download_statistics",
+		up:      execQueries(createLegacyStatisticsTableQuery),
+		down:    execQueries(`DROP TABLE download_statistics`),
+	},
+	{
+		version: 2,
+		name:    "download_statistics_by_type_and_version",
+		up:      migrateStatisticsToTypeAndVersion,
+		down:    execQueries(restoreLegacyStatisticsQueries...),
+	},
+	{
+		version: 3,
+		name:    "create_downloader_audit_log",
+		up:      execQueries(createAuditLogQueries...),
+		down:    keepAuditLog,
+	},
+	{
+		version: 4,
+		name:    "create_downloader_content_versions",
+		up:      execQueries(createContentVersionsTableQuery),
+		down:    execQueries(`DROP TABLE downloader_content_versions`),
+	},
+	{
+		version: 5,
+		name:    "add_downloader_content_versions_lifecycle",
+		up:      execQueries(addContentLifecycleColumnsQuery),
+		down:    execQueries(dropContentLifecycleColumnsQuery),
+	},
+	{
+		version: 6,
+		name:    "create_downloader_content_aliases",
+		up:      execQueries(createContentAliasesTableQuery),
+		down:    execQueries(`DROP TABLE downloader_content_aliases`),
+	},
+}
+
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+/*
+Brings the schema to the version from the `schema_version` env var, or to the latest known version if it isn't set.
+Setting the variable to a version lower than the applied one rolls the schema back by running `down` steps.
+The module can't work with a rolled back schema, so the rollback is one-shot: it's committed and then the module
+fails to load until an older build of the module is deployed and the variable is removed.
+*/
+func migrateSchema(ctx context.Context, db *sql.DB, cfg *moduleConfig) error {
+	target := latestSchemaVersion()
+	if version := cfg.SchemaVersion; version != nil {
+		target = *version
+	}
+	err := migrateSchemaTo(ctx, db, target)
+	if err != nil {
+		return err
+	}
+	if target < latestSchemaVersion() {
+		return fmt.Errorf("the schema is at version %d, while the module requires version %d: deploy a build of the module which matches the schema and remove `%s`",
+			target, latestSchemaVersion(), schemaVersionEnvVarName)
+	}
+	return nil
+}
+
+func migrateSchemaTo(ctx context.Context, db *sql.DB, target int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = applyMigrations(ctx, tx, target)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func applyMigrations(ctx context.Context, tx *sql.Tx, target int) error {
+	// The lock is released automatically when the transaction ends.
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationsLockKey)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, createSchemaMigrationsTableQuery)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = tx.QueryRowContext(ctx, `SELECT coalesce(max(version), 0) FROM downloader_schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	if target >= current {
+		for _, m := range migrations {
+			if m.version <= current || m.version > target {
+				continue
+			}
+			if err = m.up(ctx, tx); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+			}
+			_, err = tx.ExecContext(ctx, `INSERT INTO downloader_schema_migrations(version, name) VALUES($1, $2)`, m.version, m.name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version > current || m.version <= target {
+			continue
+		}
+		if err = m.down(ctx, tx); err != nil {
+			return fmt.Errorf("rollback of migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM downloader_schema_migrations WHERE version = $1`, m.version)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The audit log must outlive rollbacks, so its table is kept and the `up` step tolerates an existing one.
+func keepAuditLog(context.Context, *sql.Tx) error {
+	return nil
+}
+
+func execQueries(queries ...string) migrationStep {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		for _, query := range queries {
+			_, err := tx.ExecContext(ctx, query)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+/*
+Earlier versions of the module stored the full file path (e.g. `/data/core/1.0.0.json`) in the `file_name` column.
+Such a table is converted to the new layout: the type and the version are extracted from the last
+two segments of the path. Rows which point to the same type, version and hash (e.g. because `default_file_path`
+was changed at some point) are merged by summing their counters.
+
+The table may already have the new layout if it was created before the migrations were introduced,
+so the presence of the legacy column is checked first.
+*/
+func migrateStatisticsToTypeAndVersion(ctx context.Context, tx *sql.Tx) error {
+	var legacyColumns int
+	err := tx.QueryRowContext(ctx, legacyColumnQuery).Scan(&legacyColumns)
+	if err != nil {
+		return err
+	}
+	if legacyColumns == 0 {
+		return nil
+	}
+	return execQueries(backfillStatisticsQueries...)(ctx, tx)
+}
+
+const createSchemaMigrationsTableQuery = `
+	CREATE TABLE IF NOT EXISTS downloader_schema_migrations (
+	    version integer not null primary key,
+	    name varchar(256) not null,
+	    applied_at timestamptz not null default now()
+	)`
+
+const createLegacyStatisticsTableQuery = `
+	CREATE TABLE IF NOT EXISTS download_statistics (
+	    file_name varchar(256) not null,
+	    file_hash varchar(256) not null,
+	    download_count bigint default 0,
+	    primary key(file_name, file_hash)
+	)`
+
+const createStatisticsTableQuery = `
+	CREATE TABLE download_statistics (
+	    type varchar(256) not null,
+	    version varchar(256) not null,
+	    file_hash varchar(256) not null,
+	    download_count bigint default 0,
+	    primary key(type, version, file_hash)
+	)`
+
+const legacyColumnQuery = `
+	SELECT count(*) FROM information_schema.columns
+	WHERE table_schema = current_schema() AND table_name = 'download_statistics' AND column_name = 'file_name'`
+
+var backfillStatisticsQueries = []string{
+	`ALTER TABLE download_statistics RENAME TO download_statistics_legacy`,
+	`ALTER TABLE download_statistics_legacy RENAME CONSTRAINT download_statistics_pkey TO download_statistics_legacy_pkey`,
+	createStatisticsTableQuery,
+	`INSERT INTO download_statistics(type, version, file_hash, download_count)
+	 SELECT reverse(split_part(reverse(file_name), '/', 2)),
+	        regexp_replace(reverse(split_part(reverse(file_name), '/', 1)), '\.json$', ''),
+	        file_hash,
+	        sum(download_count)
+	 FROM download_statistics_legacy
+	 GROUP BY 1, 2, 3`,
+	`DROP TABLE download_statistics_legacy`,
+}
+
+// The original root path is unknown at this point, so the restored paths are relative to it.
+var restoreLegacyStatisticsQueries = []string{
+	`ALTER TABLE download_statistics RENAME TO download_statistics_by_type`,
+	`ALTER TABLE download_statistics_by_type RENAME CONSTRAINT download_statistics_pkey TO download_statistics_by_type_pkey`,
+	createLegacyStatisticsTableQuery,
+	`INSERT INTO download_statistics(file_name, file_hash, download_count)
+	 SELECT type || '/' || version || '.json', file_hash, download_count
+	 FROM download_statistics_by_type`,
+	`DROP TABLE download_statistics_by_type`,
+}
+
+// The rules make the table append-only: updates and deletes are silently ignored.
+var createAuditLogQueries = []string{
+	`CREATE TABLE IF NOT EXISTS downloader_audit_log (
+	    id bigserial primary key,
+	    created_at timestamptz not null default now(),
+	    actor varchar(256) not null,
+	    operation varchar(64) not null,
+	    type varchar(256) not null,
+	    version varchar(256) not null,
+	    old_hash varchar(256),
+	    new_hash varchar(256),
+	    reason text not null default ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS downloader_audit_log_type_version_idx ON downloader_audit_log(type, version)`,
+	`CREATE OR REPLACE RULE downloader_audit_log_no_update AS ON UPDATE TO downloader_audit_log DO INSTEAD NOTHING`,
+	`CREATE OR REPLACE RULE downloader_audit_log_no_delete AS ON DELETE TO downloader_audit_log DO INSTEAD NOTHING`,
+}
+
+// Only versions with non-default settings have rows in this table.
+const createContentVersionsTableQuery = `
+	CREATE TABLE downloader_content_versions (
+	    type varchar(256) not null,
+	    version varchar(256) not null,
+	    available_from timestamptz,
+	    available_until timestamptz,
+	    schedule varchar(256),
+	    schedule_duration bigint,
+	    updated_at timestamptz not null default now(),
+	    primary key(type, version)
+	)`
+
+const addContentLifecycleColumnsQuery = `
+	ALTER TABLE downloader_content_versions
+	    ADD COLUMN deprecated boolean not null default false,
+	    ADD COLUMN replacement varchar(256),
+	    ADD COLUMN removed_at timestamptz`
+
+const dropContentLifecycleColumnsQuery = `
+	ALTER TABLE downloader_content_versions
+	    DROP COLUMN deprecated,
+	    DROP COLUMN replacement,
+	    DROP COLUMN removed_at`
+
+const createContentAliasesTableQuery = `
+	CREATE TABLE downloader_content_aliases (
+	    type varchar(256) not null,
+	    alias varchar(256) not null,
+	    version varchar(256) not null,
+	    updated_at timestamptz not null default now(),
+	    primary key(type, alias)
+	)`
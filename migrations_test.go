@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestThatAllMigrationsAreAppliedToEmptyDatabase(t *testing.T) {
+	db, dbMock := createDbMock()
+	expectMigrationsBookkeeping(dbMock, 0)
+	dbMock.ExpectExec("CREATE TABLE IF NOT EXISTS download_statistics").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectMigrationRecorded(dbMock, 1)
+	dbMock.ExpectQuery("SELECT count").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	expectStatisticsBackfill(dbMock)
+	expectMigrationRecorded(dbMock, 2)
+	dbMock.ExpectCommit()
+
+	err := migrateSchemaTo(context.Background(), db, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatAppliedMigrationsAreSkipped(t *testing.T) {
+	db, dbMock := createDbMock()
+	expectMigrationsBookkeeping(dbMock, latestSchemaVersion())
+	dbMock.ExpectCommit()
+
+	err := migrateSchemaTo(context.Background(), db, latestSchemaVersion())
+	assert.NoError(t, err)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatBackfillIsSkippedIfStatisticsAlreadyHaveNewLayout(t *testing.T) {
+	db, dbMock := createDbMock()
+	expectMigrationsBookkeeping(dbMock, 1)
+	dbMock.ExpectQuery("SELECT count").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	expectMigrationRecorded(dbMock, 2)
+	dbMock.ExpectCommit()
+
+	err := migrateSchemaTo(context.Background(), db, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatMigrationsAreRolledBackInReverseOrder(t *testing.T) {
+	db, dbMock := createDbMock()
+	expectMigrationsBookkeeping(dbMock, 2)
+	dbMock.ExpectExec("ALTER TABLE download_statistics RENAME TO download_statistics_by_type").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("RENAME CONSTRAINT").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("CREATE TABLE IF NOT EXISTS download_statistics").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("INSERT INTO download_statistics").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DROP TABLE download_statistics_by_type").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM downloader_schema_migrations").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DROP TABLE download_statistics").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM downloader_schema_migrations").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	err := migrateSchemaTo(context.Background(), db, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatRollbackKeepsAuditLog(t *testing.T) {
+	db, dbMock := createDbMock()
+	expectMigrationsBookkeeping(dbMock, 3)
+	dbMock.ExpectExec("DELETE FROM downloader_schema_migrations").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	err := migrateSchemaTo(context.Background(), db, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatModuleDoesNotLoadAfterRollback(t *testing.T) {
+	db, dbMock := createDbMock()
+	expectMigrationsBookkeeping(dbMock, latestSchemaVersion())
+	dbMock.ExpectExec("DROP TABLE downloader_content_aliases").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM downloader_schema_migrations").WithArgs(latestSchemaVersion()).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+	cfg, err := loadConfig(testEnvWith(schemaVersionEnvVarName, "5"))
+	assert.NoError(t, err)
+
+	err = migrateSchema(context.Background(), db, cfg)
+	assert.ErrorContains(t, err, "the schema is at version 5")
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatFailedMigrationRollsBackTransaction(t *testing.T) {
+	db, dbMock := createDbMock()
+	expectMigrationsBookkeeping(dbMock, 0)
+	dbMock.ExpectExec("CREATE TABLE IF NOT EXISTS download_statistics").WillReturnError(assert.AnError)
+	dbMock.ExpectRollback()
+
+	err := migrateSchemaTo(context.Background(), db, 2)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func expectMigrationsBookkeeping(dbMock sqlmock.Sqlmock, current int) {
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("pg_advisory_xact_lock").WithArgs(migrationsLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("CREATE TABLE IF NOT EXISTS downloader_schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectQuery("FROM downloader_schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(current))
+}
+
+func expectMigrationRecorded(dbMock sqlmock.Sqlmock, version int) {
+	dbMock.ExpectExec("INSERT INTO downloader_schema_migrations").WithArgs(version, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectStatisticsBackfill(dbMock sqlmock.Sqlmock) {
+	dbMock.ExpectExec("ALTER TABLE download_statistics RENAME TO download_statistics_legacy").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("RENAME CONSTRAINT").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("CREATE TABLE download_statistics").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("INSERT INTO download_statistics").WillReturnResult(sqlmock.NewResult(0, 2))
+	dbMock.ExpectExec("DROP TABLE download_statistics_legacy").WillReturnResult(sqlmock.NewResult(0, 0))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const maxNameLength = 128
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+/*
+Types and versions are used as path segments, so only a safe subset of characters is allowed. Names starting with
+`.` or `_` are reserved: the former covers `.`, `..` and hidden files, the latter is left for files of the module
+which must not be downloadable.
+*/
+func validateName(field string, value string) error {
+	if value == "" {
+		return runtime.NewError(fmt.Sprintf("`%s` field must not be empty", field), invalidArgumentCode)
+	}
+	if len(value) > maxNameLength {
+		return runtime.NewError(fmt.Sprintf("`%s` field must not be longer than %d characters", field, maxNameLength), invalidArgumentCode)
+	}
+	if strings.Contains(value, "/") {
+		return runtime.NewError(fmt.Sprintf("`%s` field must not contain /", field), invalidArgumentCode)
+	}
+	if value == "." || value == ".." {
+		return runtime.NewError(fmt.Sprintf("`%s` field must not be . or ..", field), invalidArgumentCode)
+	}
+	if strings.HasPrefix(value, ".") || strings.HasPrefix(value, "_") {
+		return runtime.NewError(fmt.Sprintf("`%s` field must not start with . or _", field), invalidArgumentCode)
+	}
+	if !namePattern.MatchString(value) {
+		return runtime.NewError(fmt.Sprintf("`%s` field may contain only letters, digits, ., _ and -", field), invalidArgumentCode)
+	}
+	return nil
+}
+
+/*
+Returns the canonical path of the file after evaluation of all symlinks. Validation of names guarantees that
+the joined path is inside the root, but a symlink inside the root may still point anywhere, e.g. to `/etc`.
+That's why the canonical path is checked to stay under one of the canonical roots.
+*/
+func resolveFilePath(cfg *moduleConfig, filePath string) (string, error) {
+	canonicalFile, err := canonicalPath(filePath)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range cfg.Roots {
+		canonicalRoot, err := canonicalPath(root.Path)
+		if err != nil {
+			// Missing roots are allowed, e.g. a hotfix folder which is created only when it's needed.
+			continue
+		}
+		if isInsideRoot(canonicalRoot, canonicalFile) {
+			return canonicalFile, nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside of the root folder", filePath)
+}
+
+func canonicalPath(path string) (string, error) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(absolute)
+}
+
+func isInsideRoot(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
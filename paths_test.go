@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestThatInvalidNamesAreRejected(t *testing.T) {
+	for _, name := range []string{"", ".", "..", ".hidden", "_schema", "core\x00", "co re", "core\\1", strings.Repeat("a", maxNameLength+1)} {
+		err := validateName("type", name)
+		assertErrorCode(t, err, invalidArgumentCode)
+	}
+}
+
+func TestThatValidNamesAreAccepted(t *testing.T) {
+	for _, name := range []string{"core", "1.0.0", "ugc-level_42", "v1..2", strings.Repeat("a", maxNameLength)} {
+		assert.NoError(t, validateName("version", name))
+	}
+}
+
+func TestThatErrorWillBeRaisedIfVersionIsEmpty(t *testing.T) {
+	db, _ := createDbMock()
+	payload := buildPayload("core", "", nil)
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), payload)
+	assert.EqualError(t, err, "`version` field must not be empty")
+	assert.Equal(t, "{}", res)
+}
+
+func TestThatSymlinkPointingOutsideOfRootIsNotFollowed(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(outside, "secret.json"), []byte("{}"), 0o600))
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "core"), 0o700))
+	assert.NoError(t, os.Symlink(filepath.Join(outside, "secret.json"), filepath.Join(root, "core", "1.0.0.json")))
+	assert.NoError(t, os.Symlink(outside, filepath.Join(root, "linked")))
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	db, _ := createDbMock()
+
+	for _, typeName := range []string{"core", "linked"} {
+		version := "1.0.0"
+		if typeName == "linked" {
+			version = "secret"
+		}
+		res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload(typeName, version, nil))
+		assertErrorCode(t, err, notFoundCode)
+		assert.Equal(t, "{}", res)
+	}
+}
+
+func TestThatSymlinkInsideOfRootIsFollowed(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "core"), 0o700))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "core", "1.0.0.json"), []byte("{}"), 0o600))
+	assert.NoError(t, os.Symlink("1.0.0.json", filepath.Join(root, "core", "1.0.1.json")))
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("core", "1.0.1", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", *unmarshalResponse(res).Content)
+}
+
+func FuzzValidateName(f *testing.F) {
+	for _, seed := range []string{"core", "1.0.0", "..", "../core", "/etc", "_schema", ".git", "a\x00b", ""} {
+		f.Add(seed)
+	}
+	root := filepath.Join("data", "content")
+	f.Fuzz(func(t *testing.T, name string) {
+		if validateName("type", name) != nil {
+			return
+		}
+		if !namePattern.MatchString(name) || len(name) > maxNameLength || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+			t.Fatalf("%q must not be accepted", name)
+		}
+		joined := filepath.Join(root, name, name) + ".json"
+		if filepath.Dir(filepath.Dir(joined)) != root {
+			t.Fatalf("%q escapes the root folder: %s", name, joined)
+		}
+	})
+}
+
+func FuzzIsInsideRoot(f *testing.F) {
+	for _, seed := range []string{"core/1.0.0.json", "../etc/passwd", "..", ".", "core/../../x", "..core/1.json"} {
+		f.Add(seed)
+	}
+	root := "/data"
+	f.Fuzz(func(t *testing.T, rel string) {
+		path := filepath.Join(root, rel)
+		inside := isInsideRoot(root, path)
+		expected := strings.HasPrefix(path, root+string(filepath.Separator))
+		if inside != expected {
+			t.Fatalf("isInsideRoot(%q) = %v, expected %v", path, inside, expected)
+		}
+	})
+}
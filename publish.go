@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"os"
+	"path/filepath"
+)
+
+type PublishRequest struct {
+	Type    string `json:"type"`
+	Version string `json:"version"`
+	Content string `json:"content"`
+	// Existing versions are not replaced unless it's explicitly requested.
+	Overwrite bool   `json:"overwrite"`
+	Reason    string `json:"reason"`
+}
+
+type PublishResponse struct {
+	Type    string `json:"type"`
+	Version string `json:"version"`
+	Hash    string `json:"hash"`
+}
+
+/*
+Publishes a new version of content, e.g. from a CI pipeline with the HTTP key. The content is validated, encrypted
+if the type has a key, and written atomically: to a temporary file in the same folder, which is then renamed,
+so clients never see a partially written file.
+*/
+func RpcDownloaderPublish(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	err := checkServerToServer(ctx)
+	if err != nil {
+		return "{}", err
+	}
+	var req PublishRequest
+	err = json.Unmarshal([]byte(payload), &req)
+	if err != nil {
+		logger.Info("Unable to deserialize request %v", err)
+		return "{}", runtime.NewError("Unable to deserialize request", invalidArgumentCode)
+	}
+	err = validateRequest(DownloaderRequest{Type: req.Type, Version: req.Version})
+	if err != nil {
+		return "{}", err
+	}
+	content := []byte(req.Content)
+	if !json.Valid(content) {
+		return "{}", runtime.NewError("`content` must be a valid JSON document", invalidArgumentCode)
+	}
+	cfg := currentConfig()
+	schema, err := loadContentSchema(cfg, req.Type)
+	if err != nil {
+		logger.Error("Unable to load the schema of %s: %v", req.Type, err)
+		return "{}", runtime.NewError(fmt.Sprintf("Unable to load the schema of `%s`", req.Type), internalErrorCode)
+	}
+	if schema != nil {
+		if errs := validateContent(schema, content); len(errs) > 0 {
+			return "{}", schemaMismatchError(req.Type, errs)
+		}
+	}
+	key, encrypted := encryptionKeyFor(cfg.EncryptionKeys, req.Type)
+	stored := content
+	if encrypted {
+		stored, err = encryptContent(key, req.Type, content)
+		if err != nil {
+			return "{}", err
+		}
+	}
+	// The limit applies to the stored file, as it's checked on download, so it includes the encryption overhead.
+	if maxFileSize := maxFileSizeFor(cfg.MaxFileSizes, req.Type); int64(len(stored)) > maxFileSize {
+		return "{}", fileTooLargeError(req.Type, maxFileSize)
+	}
+
+	snapshot, err := currentContentMetadata(ctx, logger, db)
+	if err != nil {
+		return "{}", err
+	}
+	if metadata := snapshot.version(req.Type, req.Version); metadata.RemovedAt != nil {
+		return "{}", removedError(req.Type, req.Version, metadata.Replacement)
+	}
+	if _, ok := snapshot.alias(req.Type, req.Version); ok {
+		return "{}", runtime.NewError(fmt.Sprintf("`%s` is an alias of `%s`, it can't be a version", req.Version, req.Type), invalidArgumentCode)
+	}
+
+	// Content is always published to `default_file_path`, other roots are managed outside of the module.
+	if root, ok := shadowingRoot(cfg, req.Type, req.Version); ok {
+		return "{}", runtime.NewError(fmt.Sprintf("Version `%s` of `%s` is served from the `%s` root, remove it there first", req.Version, req.Type, root.Name), failedPreconditionCode)
+	}
+	filePath := contentFilePath(cfg, cfg.FilePath, req.Type, req.Version)
+
+	// The previous content is kept to restore it if the audit record can't be committed.
+	previous, err := os.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Error("Unable to read the current version of %s: %v", filePath, err)
+		return "{}", runtime.NewError("Unable to publish content", internalErrorCode)
+	}
+	var oldHash *string
+	if previous != nil {
+		if !req.Overwrite {
+			return "{}", alreadyPublishedError(req.Type, req.Version)
+		}
+		oldHash, err = storedContentHash(previous, req.Type, key, encrypted)
+		if err != nil {
+			logger.Error("Unable to read the current version of %s: %v", filePath, err)
+			return "{}", runtime.NewError("Unable to publish content", internalErrorCode)
+		}
+	}
+	hash := contentHash(content)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to publish content: %v", err)
+		return "{}", runtime.NewError("Unable to publish content", internalErrorCode)
+	}
+	err = writeAuditRecord(ctx, tx, auditRecord{
+		Actor: auditActor(ctx), Operation: "publish", Type: req.Type, Version: req.Version,
+		OldHash: oldHash, NewHash: &hash, Reason: req.Reason,
+	})
+	if err == nil {
+		err = writeFileAtomically(filePath, stored, req.Overwrite)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		if os.IsExist(err) {
+			return "{}", alreadyPublishedError(req.Type, req.Version)
+		}
+		logger.Error("Failed to publish content: %v", err)
+		return "{}", runtime.NewError("Unable to publish content", internalErrorCode)
+	}
+	if err = tx.Commit(); err != nil {
+		logger.Error("Failed to publish content: %v", err)
+		if restoreErr := restoreFile(filePath, previous); restoreErr != nil {
+			logger.Error("Content %s is published, but the audit record is lost: %v", filePath, restoreErr)
+		}
+		return "{}", runtime.NewError("Unable to publish content", internalErrorCode)
+	}
+	// The new content is valid, so a previously quarantined version can be served again.
+	quarantinedContent.release(req.Type, req.Version)
+	recordQuarantinedVersions(nk)
+
+	if err = createPopularContentLeaderboard(ctx, nk, req.Type); err != nil {
+		logger.Warn("Failed to create popular content leaderboard: %v", err)
+	}
+	if err = syncCatalogType(ctx, logger, db, nk, cfg, req.Type); err != nil {
+		logger.Warn("Failed to update the content catalog: %v", err)
+	}
+
+	respStr, err := json.Marshal(PublishResponse{Type: req.Type, Version: req.Version, Hash: hash})
+	if err != nil {
+		return "{}", err
+	}
+	return string(respStr[:]), nil
+}
+
+func alreadyPublishedError(typeName string, version string) *runtime.Error {
+	return runtime.NewError(fmt.Sprintf("Version `%s` of `%s` already exists", version, typeName), alreadyExistsCode)
+}
+
+func readContentHash(filePath string, typeName string, key []byte, encrypted bool) (*string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return storedContentHash(content, typeName, key, encrypted)
+}
+
+func storedContentHash(content []byte, typeName string, key []byte, encrypted bool) (*string, error) {
+	if encrypted {
+		var err error
+		content, err = decryptContent(key, typeName, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	hash := contentHash(content)
+	return &hash, nil
+}
+
+// restoreFile brings back the previous content of a file, or removes the file if it didn't exist.
+func restoreFile(filePath string, previous []byte) error {
+	if previous == nil {
+		return os.Remove(filePath)
+	}
+	return writeFileAtomically(filePath, previous, true)
+}
+
+// writeFileAtomically replaces the file with a fully written one. Without overwrite the file is linked instead
+// of renamed, so the write fails with os.ErrExist if the file has been created concurrently.
+func writeFileAtomically(filePath string, content []byte, overwrite bool) error {
+	dir := filepath.Dir(filePath)
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".publish-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(tmp.Name()))
+	}
+	if overwrite {
+		err = os.Rename(tmp.Name(), filePath)
+		if err != nil {
+			return errors.Join(err, os.Remove(tmp.Name()))
+		}
+		return nil
+	}
+	err = os.Link(tmp.Name(), filePath)
+	if removeErr := os.Remove(tmp.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
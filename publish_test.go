@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestThatContentIsPublished(t *testing.T) {
+	root := t.TempDir()
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	db, dbMock := createDbMock()
+	newHash := "3181399843"
+	dbMock.ExpectBegin()
+	dbMock.
+		ExpectExec("insert into downloader_audit_log").
+		WithArgs("server", "publish", "custom", "5.0.0", nil, &newHash, "release").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+	mockNakamaModule := buildNakamaModuleMock(t)
+	mockNakamaModule.On("LeaderboardCreate", mock.Anything, "popular_content_custom", true, "desc", "incr", "", mock.Anything).Return(nil).Once()
+
+	res, err := RpcDownloaderPublish(context.Background(), buildLoggerMock(), db, mockNakamaModule,
+		`{"type": "custom", "version": "5.0.0", "content": "{\"custom\": \"5.0.0\"}", "reason": "release"}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type": "custom", "version": "5.0.0", "hash": "3181399843"}`, res)
+	content, err := os.ReadFile(filepath.Join(root, "custom", "5.0.0.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"custom": "5.0.0"}`, string(content))
+	entries, err := os.ReadDir(filepath.Join(root, "custom"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatExistingVersionIsNotOverwrittenByDefault(t *testing.T) {
+	root := t.TempDir()
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	writeContentFile(t, root, "custom", "5.0.0", []byte(`{"custom": "5.0.0"}`))
+	db, _ := createDbMock()
+
+	res, err := RpcDownloaderPublish(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "custom", "version": "5.0.0", "content": "{}"}`)
+	assertErrorCode(t, err, alreadyExistsCode)
+	assert.Equal(t, "{}", res)
+}
+
+func TestThatOverwriteRecordsOldHash(t *testing.T) {
+	root := t.TempDir()
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	writeContentFile(t, root, "custom", "5.0.0", []byte(`{"custom": "5.0.0"}`))
+	db, dbMock := createDbMock()
+	oldHash := "3181399843"
+	newHash := contentHash([]byte("{}"))
+	dbMock.ExpectBegin()
+	dbMock.
+		ExpectExec("insert into downloader_audit_log").
+		WithArgs("server", "publish", "custom", "5.0.0", &oldHash, &newHash, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+	mockNakamaModule := buildNakamaModuleMock(t)
+	mockNakamaModule.On("LeaderboardCreate", mock.Anything, "popular_content_custom", true, "desc", "incr", "", mock.Anything).Return(nil).Once()
+
+	_, err := RpcDownloaderPublish(context.Background(), buildLoggerMock(), db, mockNakamaModule,
+		`{"type": "custom", "version": "5.0.0", "content": "{}", "overwrite": true}`)
+	assert.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(root, "custom", "5.0.0.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", string(content))
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatFileIsNotWrittenIfAuditRecordFails(t *testing.T) {
+	root := t.TempDir()
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	db, dbMock := createDbMock()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("insert into downloader_audit_log").WillReturnError(assert.AnError)
+	dbMock.ExpectRollback()
+
+	_, err := RpcDownloaderPublish(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "custom", "version": "5.0.0", "content": "{}"}`)
+	assertErrorCode(t, err, internalErrorCode)
+	_, err = os.Stat(filepath.Join(root, "custom", "5.0.0.json"))
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatFileIsRestoredIfAuditRecordIsNotCommitted(t *testing.T) {
+	root := t.TempDir()
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	writeContentFile(t, root, "custom", "5.0.0", []byte(`{"custom": "5.0.0"}`))
+	db, dbMock := createDbMock()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("insert into downloader_audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit().WillReturnError(assert.AnError)
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("insert into downloader_audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit().WillReturnError(assert.AnError)
+
+	_, err := RpcDownloaderPublish(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "custom", "version": "5.0.0", "content": "{}", "overwrite": true}`)
+	assertErrorCode(t, err, internalErrorCode)
+	content, err := os.ReadFile(filepath.Join(root, "custom", "5.0.0.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"custom": "5.0.0"}`, string(content))
+
+	_, err = RpcDownloaderPublish(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "custom", "version": "6.0.0", "content": "{}"}`)
+	assertErrorCode(t, err, internalErrorCode)
+	entries, err := os.ReadDir(filepath.Join(root, "custom"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatConcurrentlyCreatedFileIsNotOverwritten(t *testing.T) {
+	root := t.TempDir()
+	writeContentFile(t, root, "custom", "5.0.0", []byte(`{"custom": "5.0.0"}`))
+	filePath := filepath.Join(root, "custom", "5.0.0.json")
+
+	err := writeFileAtomically(filePath, []byte("{}"), false)
+	assert.True(t, os.IsExist(err))
+	content, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"custom": "5.0.0"}`, string(content))
+	entries, err := os.ReadDir(filepath.Join(root, "custom"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestThatSizeLimitIncludesEncryptionOverhead(t *testing.T) {
+	root := t.TempDir()
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	setConfigValue(t, maxFileSizesEnvVarName, `{"custom": 20}`)
+	setConfigValue(t, encryptionKeysEnvVarName, `{"custom": "`+base64.StdEncoding.EncodeToString(testEncryptionKey)+`"}`)
+	db, _ := createDbMock()
+
+	// The plain content is 19 bytes, but the encrypted one doesn't fit into the limit.
+	_, err := RpcDownloaderPublish(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "custom", "version": "5.0.0", "content": "{\"custom\": \"5.0.0\"}"}`)
+	assertErrorCode(t, err, resourceExhaustedCode)
+	_, err = os.Stat(filepath.Join(root, "custom", "5.0.0.json"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestThatInvalidPublicationIsRejected(t *testing.T) {
+	db, _ := createDbMock()
+	for _, payload := range []string{
+		`{"type": "../core", "version": "1.0.0", "content": "{}"}`,
+		`{"type": "core", "version": "", "content": "{}"}`,
+		`{"type": "core", "version": "2.0.0", "content": "{not json"}`,
+		`not json`,
+	} {
+		_, err := RpcDownloaderPublish(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), payload)
+		assertErrorCode(t, err, invalidArgumentCode)
+	}
+}
+
+func TestThatPublicationIsNotAvailableToUsers(t *testing.T) {
+	db, _ := createDbMock()
+
+	_, err := RpcDownloaderPublish(userContext("user-1"), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "core", "version": "2.0.0", "content": "{}"}`)
+	assertErrorCode(t, err, permissionDeniedCode)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type QuarantineResponse struct {
+	Versions []QuarantinedVersion `json:"versions"`
+}
+
+type QuarantinedVersion struct {
+	Type    string   `json:"type"`
+	Version string   `json:"version"`
+	Errors  []string `json:"errors"`
+}
+
+/*
+Versions which don't match the schema of their type. They are found by the sweep on startup and by
+the DownloaderValidateContent RPC, and they are not served until they are fixed: it's better to let
+clients keep their cached version than to crash them. Every node of the cluster sweeps its own content.
+*/
+type contentQuarantine struct {
+	mu       sync.RWMutex
+	versions map[contentKey][]string
+}
+
+var quarantinedContent = &contentQuarantine{}
+
+func (q *contentQuarantine) contains(typeName string, version string) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	_, ok := q.versions[contentKey{Type: typeName, Version: version}]
+	return ok
+}
+
+func (q *contentQuarantine) count() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return len(q.versions)
+}
+
+func (q *contentQuarantine) replace(versions map[contentKey][]string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.versions = versions
+}
+
+func (q *contentQuarantine) release(typeName string, version string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.versions, contentKey{Type: typeName, Version: version})
+}
+
+func quarantinedError(typeName string, version string) error {
+	return runtime.NewError(fmt.Sprintf("Version `%s` of `%s` is temporarily unavailable", version, typeName), unavailableCode)
+}
+
+func schemaMismatchError(typeName string, errs []string) error {
+	return runtime.NewError(fmt.Sprintf("Content doesn't match the schema of `%s`: %s", typeName, strings.Join(errs, "; ")), invalidArgumentCode)
+}
+
+/*
+Validates every version of every type which has a schema and replaces the quarantine with the invalid ones.
+A broken schema is reported, but versions of its type are not quarantined: it's a mistake of the schema author,
+not of the content.
+*/
+func sweepContent(logger runtime.Logger, nk runtime.NakamaModule, cfg *moduleConfig) (map[contentKey][]string, error) {
+	types, err := listAllContentTypes(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	invalid := make(map[contentKey][]string)
+	for _, typeName := range types {
+		schema, err := loadContentSchema(cfg, typeName)
+		if err != nil {
+			logger.Error("Unable to load the schema of %s, its content is not validated: %v", typeName, err)
+			continue
+		}
+		if schema == nil {
+			continue
+		}
+		versions, _, err := listAllContentVersions(cfg, typeName)
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range versions {
+			errs := validateStoredContent(cfg, schema, typeName, version)
+			if len(errs) > 0 {
+				logger.Error("Version %s of %s doesn't match the schema and is quarantined: %s", version, typeName, strings.Join(errs, "; "))
+				invalid[contentKey{Type: typeName, Version: version}] = errs
+			}
+		}
+	}
+	quarantinedContent.replace(invalid)
+	recordQuarantinedVersions(nk)
+	return invalid, nil
+}
+
+// Unreadable files are quarantined too: they would fail on download anyway, but with a less clear reason.
+func validateStoredContent(cfg *moduleConfig, schema interface{}, typeName string, version string) []string {
+	filePath, err := buildFilePath(cfg, typeName, version)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	resolvedPath, err := resolveFilePath(cfg, filePath)
+	if err != nil {
+		return []string{fmt.Sprintf("unable to resolve the file: %v", err)}
+	}
+	content, err := readFileWithLimit(resolvedPath, maxFileSizeFor(cfg.MaxFileSizes, typeName))
+	if errors.Is(err, errFileTooLarge) {
+		return []string{"the file exceeds the maximum size"}
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("unable to read the file: %v", err)}
+	}
+	if key, ok := encryptionKeyFor(cfg.EncryptionKeys, typeName); ok {
+		content, err = decryptContent(key, typeName, content)
+		if err != nil {
+			return []string{fmt.Sprintf("unable to decrypt the file: %v", err)}
+		}
+	}
+	return validateContent(schema, content)
+}
+
+// Re-validates all content, e.g. after files or schemas were changed on the disk, and returns quarantined versions.
+func RpcDownloaderValidateContent(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	err := checkServerToServer(ctx)
+	if err != nil {
+		return "{}", err
+	}
+	cfg := currentConfig()
+	invalid, err := sweepContent(logger, nk, cfg)
+	if err != nil {
+		logger.Error("Unable to validate content: %v", err)
+		return "{}", runtime.NewError("Unable to validate content", internalErrorCode)
+	}
+	// Statuses of quarantined versions have changed, and the files may have changed too.
+	if err = syncCatalog(ctx, logger, db, nk, cfg); err != nil {
+		logger.Warn("Failed to update the content catalog: %v", err)
+	}
+
+	resp := QuarantineResponse{Versions: []QuarantinedVersion{}}
+	for key, errs := range invalid {
+		resp.Versions = append(resp.Versions, QuarantinedVersion{Type: key.Type, Version: key.Version, Errors: errs})
+	}
+	sort.Slice(resp.Versions, func(i, j int) bool {
+		if resp.Versions[i].Type != resp.Versions[j].Type {
+			return resp.Versions[i].Type < resp.Versions[j].Type
+		}
+		return resp.Versions[i].Version < resp.Versions[j].Version
+	})
+	respStr, err := json.Marshal(resp)
+	if err != nil {
+		return "{}", err
+	}
+	return string(respStr[:]), nil
+}
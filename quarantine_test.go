@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func useContentRootWithSchema(t *testing.T) string {
+	root := t.TempDir()
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	writeContentFile(t, root, "custom", "1.0.0", []byte(`{"custom": "1.0.0"}`))
+	writeContentFile(t, root, "custom", "2.0.0", []byte(`{"custom": 2}`))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "custom", schemaFileName),
+		[]byte(`{"type": "object", "properties": {"custom": {"type": "string"}}}`), 0o600))
+	t.Cleanup(func() { quarantinedContent.replace(nil) })
+	return root
+}
+
+func TestThatInvalidContentIsQuarantined(t *testing.T) {
+	useContentRootWithSchema(t)
+	db, _ := createDbMock()
+
+	res, err := RpcDownloaderValidateContent(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), "")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"versions": [{"type": "custom", "version": "2.0.0", "errors": ["/custom: must be of type string"]}]}`, res)
+
+	_, err = RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "2.0.0", nil))
+	assertErrorCode(t, err, unavailableCode)
+	res, err = RpcFileList(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom"}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"types": [{"type": "custom", "versions": ["1.0.0"]}]}`, res)
+}
+
+func TestThatPublicationOfInvalidContentIsRefused(t *testing.T) {
+	useContentRootWithSchema(t)
+	db, _ := createDbMock()
+
+	_, err := RpcDownloaderPublish(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "custom", "version": "3.0.0", "content": "{\"custom\": 3}"}`)
+	assertErrorCode(t, err, invalidArgumentCode)
+	assert.Contains(t, err.Error(), "/custom: must be of type string")
+}
+
+func TestThatContentValidationIsNotAvailableToUsers(t *testing.T) {
+	db, _ := createDbMock()
+
+	_, err := RpcDownloaderValidateContent(userContext("user-1"), buildLoggerMock(), db, buildNakamaModuleMock(t), "")
+	assertErrorCode(t, err, permissionDeniedCode)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"math"
+	"sync"
+	"time"
+)
+
+const rateLimitsEnvVarName string = "rate_limits"
+
+// The limiter keeps at most this number of buckets, the least recently used ones are evicted first.
+const maxRateLimiterBuckets = 100_000
+
+/*
+The `rate_limits` env var contains a JSON object where keys are types (`*` for types without their own limit)
+and values are token bucket parameters: `rate` is the number of requests per second, `burst` is the size of the bucket.
+
+	{"*": {"rate": 1, "burst": 10}, "ugc": {"rate": 0.2, "burst": 3}}
+
+Limits are applied separately to every user and to every client IP. If the env var is not set, there are no limits.
+*/
+type rateLimit struct {
+	Rate  float64 `json:"rate" yaml:"rate"`
+	Burst float64 `json:"burst" yaml:"burst"`
+}
+
+var downloadLimiter = newRateLimiter(maxRateLimiterBuckets, time.Now)
+
+type rateLimiter struct {
+	mu         sync.Mutex
+	maxBuckets int
+	now        func() time.Time
+	buckets    map[string]*list.Element
+	// Buckets ordered by the time of the last use, the most recent ones are in front.
+	recent *list.List
+}
+
+type tokenBucket struct {
+	key       string
+	tokens    float64
+	updatedAt time.Time
+}
+
+func newRateLimiter(maxBuckets int, now func() time.Time) *rateLimiter {
+	return &rateLimiter{
+		maxBuckets: maxBuckets,
+		now:        now,
+		buckets:    make(map[string]*list.Element),
+		recent:     list.New(),
+	}
+}
+
+func parseRateLimits(value string) (map[string]rateLimit, error) {
+	var limits map[string]rateLimit
+	err := json.Unmarshal([]byte(value), &limits)
+	if err != nil {
+		return nil, err
+	}
+	for typeName, limit := range limits {
+		if err = validateRateLimit(limit); err != nil {
+			return nil, fmt.Errorf("`%s`: %w", typeName, err)
+		}
+	}
+	return limits, nil
+}
+
+func validateRateLimit(limit rateLimit) error {
+	if limit.Rate <= 0 || limit.Burst < 1 {
+		return fmt.Errorf("must have a positive rate and a burst of at least 1")
+	}
+	return nil
+}
+
+func rateLimitFor(limits map[string]rateLimit, typeName string) (rateLimit, bool) {
+	if limit, ok := limits[typeName]; ok {
+		return limit, true
+	}
+	limit, ok := limits[anyTypeKey]
+	return limit, ok
+}
+
+func checkRateLimit(ctx context.Context, limiter *rateLimiter, limits map[string]rateLimit, typeName string) error {
+	limit, ok := rateLimitFor(limits, typeName)
+	if !ok {
+		return nil
+	}
+	var keys []string
+	if userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); userId != "" {
+		keys = append(keys, "user:"+userId+":"+typeName)
+	}
+	if clientIp, _ := ctx.Value(runtime.RUNTIME_CTX_CLIENT_IP).(string); clientIp != "" {
+		keys = append(keys, "ip:"+clientIp+":"+typeName)
+	}
+	retryAfter := limiter.take(keys, limit)
+	if retryAfter > 0 {
+		seconds := int64(math.Ceil(retryAfter.Seconds()))
+		return runtime.NewError(fmt.Sprintf("Too many requests for `%s`, retry after %d seconds", typeName, seconds), resourceExhaustedCode)
+	}
+	return nil
+}
+
+/*
+Takes a token from every bucket. Tokens are taken only if all buckets have them, otherwise the time after which
+the request can be retried is returned.
+*/
+func (l *rateLimiter) take(keys []string, limit rateLimit) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var retryAfter time.Duration
+	buckets := make([]*tokenBucket, 0, len(keys))
+	for _, key := range keys {
+		bucket := l.bucket(key, limit, now)
+		bucket.tokens = math.Min(limit.Burst, bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*limit.Rate)
+		bucket.updatedAt = now
+		if bucket.tokens < 1 {
+			wait := time.Duration((1 - bucket.tokens) / limit.Rate * float64(time.Second))
+			if wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return 0
+}
+
+func (l *rateLimiter) bucket(key string, limit rateLimit, now time.Time) *tokenBucket {
+	if element, ok := l.buckets[key]; ok {
+		l.recent.MoveToFront(element)
+		return element.Value.(*tokenBucket)
+	}
+	if l.recent.Len() >= l.maxBuckets {
+		oldest := l.recent.Back()
+		l.recent.Remove(oldest)
+		delete(l.buckets, oldest.Value.(*tokenBucket).key)
+	}
+	bucket := &tokenBucket{key: key, tokens: limit.Burst, updatedAt: now}
+	l.buckets[key] = l.recent.PushFront(bucket)
+	return bucket
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestThatRequestsAreLimitedPerUser(t *testing.T) {
+	clock := time.Unix(0, 0)
+	limiter := newRateLimiter(10, func() time.Time { return clock })
+	limits := map[string]rateLimit{"core": {Rate: 0.5, Burst: 2}}
+	ctx := userContext("user-1")
+
+	assert.NoError(t, checkRateLimit(ctx, limiter, limits, "core"))
+	assert.NoError(t, checkRateLimit(ctx, limiter, limits, "core"))
+	err := checkRateLimit(ctx, limiter, limits, "core")
+	assertErrorCode(t, err, resourceExhaustedCode)
+	assert.EqualError(t, err, "Too many requests for `core`, retry after 2 seconds")
+
+	// Other users and other types have their own buckets.
+	assert.NoError(t, checkRateLimit(userContext("user-2"), limiter, limits, "core"))
+	assert.NoError(t, checkRateLimit(ctx, limiter, limits, "custom"))
+
+	clock = clock.Add(2 * time.Second)
+	assert.NoError(t, checkRateLimit(ctx, limiter, limits, "core"))
+}
+
+func TestThatRequestsAreLimitedPerClientIp(t *testing.T) {
+	clock := time.Unix(0, 0)
+	limiter := newRateLimiter(10, func() time.Time { return clock })
+	limits := map[string]rateLimit{"*": {Rate: 1, Burst: 1}}
+	firstUser := context.WithValue(userContext("user-1"), runtime.RUNTIME_CTX_CLIENT_IP, "10.0.0.1")
+	secondUser := context.WithValue(userContext("user-2"), runtime.RUNTIME_CTX_CLIENT_IP, "10.0.0.1")
+
+	assert.NoError(t, checkRateLimit(firstUser, limiter, limits, "core"))
+	assertErrorCode(t, checkRateLimit(secondUser, limiter, limits, "core"), resourceExhaustedCode)
+	// The denied request must not take a token from the bucket of the second user.
+	clock = clock.Add(time.Second)
+	assert.NoError(t, checkRateLimit(secondUser, limiter, limits, "core"))
+}
+
+func TestThatLeastRecentlyUsedBucketsAreEvicted(t *testing.T) {
+	clock := time.Unix(0, 0)
+	limiter := newRateLimiter(2, func() time.Time { return clock })
+	limits := map[string]rateLimit{"*": {Rate: 1, Burst: 1}}
+
+	for _, userId := range []string{"user-1", "user-2", "user-3"} {
+		assert.NoError(t, checkRateLimit(userContext(userId), limiter, limits, "core"))
+	}
+	assert.Len(t, limiter.buckets, 2)
+	assert.NotContains(t, limiter.buckets, "user:user-1:core")
+}
+
+func TestThatDownloaderReturnsResourceExhaustedError(t *testing.T) {
+	setConfigValue(t, rateLimitsEnvVarName, `{"custom": {"rate": 0.001, "burst": 1}}`)
+	db, _ := createDbMock()
+	ctx := userContext("rate-limited-user")
+
+	_, err := RpcFileDownloader(ctx, buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "5.0.0", nil))
+	assert.NoError(t, err)
+	res, err := RpcFileDownloader(ctx, buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "5.0.0", nil))
+	assertErrorCode(t, err, resourceExhaustedCode)
+	assert.Equal(t, "{}", res)
+}
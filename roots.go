@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const contentRootsEnvVarName = "content_roots"
+
+// The name of the root from `default_file_path`, unless it's listed in `content_roots` under another name.
+const defaultRootName = "default"
+
+/*
+Content can be stored in several roots, e.g. a hotfix folder which shadows the base content. Roots are checked
+in the order of `content_roots`, and the first one which contains the requested version wins. `default_file_path`
+is the last root unless it's listed explicitly. The module itself writes only to `default_file_path`.
+*/
+type contentRoot struct {
+	Name string `json:"name" yaml:"name"`
+	Path string `json:"path" yaml:"path"`
+}
+
+func parseContentRoots(value string) ([]contentRoot, error) {
+	var roots []contentRoot
+	err := json.Unmarshal([]byte(value), &roots)
+	if err != nil {
+		return nil, err
+	}
+	return roots, nil
+}
+
+// Appends the default root and checks that roots can be told apart in listings.
+func buildContentRoots(roots []contentRoot, defaultPath string) ([]contentRoot, error) {
+	result := make([]contentRoot, 0, len(roots)+1)
+	names := make(map[string]bool, len(roots)+1)
+	hasDefault := false
+	for i, root := range roots {
+		if err := validateName("name", root.Name); err != nil {
+			return nil, fmt.Errorf("root %d: %w", i, err)
+		}
+		if root.Path == "" {
+			return nil, fmt.Errorf("root `%s`: `path` must not be empty", root.Name)
+		}
+		if names[root.Name] {
+			return nil, fmt.Errorf("root `%s` is listed twice", root.Name)
+		}
+		names[root.Name] = true
+		hasDefault = hasDefault || filepath.Clean(root.Path) == filepath.Clean(defaultPath)
+		result = append(result, root)
+	}
+	if !hasDefault {
+		if names[defaultRootName] {
+			return nil, fmt.Errorf("root name `%s` is reserved for `%s`", defaultRootName, defaultFilePathEnvVarName)
+		}
+		result = append(result, contentRoot{Name: defaultRootName, Path: defaultPath})
+	}
+	return result, nil
+}
+
+func contentFilePath(cfg *moduleConfig, root string, typeName string, version string) string {
+	return filepath.Join(root, typeName, version) + extensionFor(cfg.Extensions, typeName)
+}
+
+/*
+Returns the root which serves the version. If no root contains it, the default root is returned, so errors
+and publications refer to `default_file_path`. An unreadable file doesn't fall through to the next root,
+otherwise a broken override would silently serve the base content.
+*/
+func findContentRoot(cfg *moduleConfig, typeName string, version string) contentRoot {
+	for _, root := range cfg.Roots {
+		_, err := os.Stat(contentFilePath(cfg, root.Path, typeName, version))
+		if err == nil || !os.IsNotExist(err) {
+			return root
+		}
+	}
+	return defaultRoot(cfg)
+}
+
+/*
+Returns the root which serves the version instead of the default root, i.e. a root with a higher priority
+which contains the version. Content published to the default root would never be served then.
+*/
+func shadowingRoot(cfg *moduleConfig, typeName string, version string) (contentRoot, bool) {
+	defaultPath := filepath.Clean(cfg.FilePath)
+	for _, root := range cfg.Roots {
+		if filepath.Clean(root.Path) == defaultPath {
+			return contentRoot{}, false
+		}
+		_, err := os.Stat(contentFilePath(cfg, root.Path, typeName, version))
+		if err == nil || !os.IsNotExist(err) {
+			return root, true
+		}
+	}
+	return contentRoot{}, false
+}
+
+func defaultRoot(cfg *moduleConfig) contentRoot {
+	for _, root := range cfg.Roots {
+		if filepath.Clean(root.Path) == filepath.Clean(cfg.FilePath) {
+			return root
+		}
+	}
+	return contentRoot{Name: defaultRootName, Path: cfg.FilePath}
+}
+
+// Paths of the version in all roots which contain it, e.g. to delete the version everywhere.
+func existingContentFilePaths(cfg *moduleConfig, typeName string, version string) []string {
+	var paths []string
+	for _, root := range cfg.Roots {
+		filePath := contentFilePath(cfg, root.Path, typeName, version)
+		if _, err := os.Stat(filePath); err == nil {
+			paths = append(paths, filePath)
+		}
+	}
+	return paths
+}
+
+// Types found in any root.
+func listAllContentTypes(cfg *moduleConfig) ([]string, error) {
+	seen := make(map[string]bool)
+	var types []string
+	found := false
+	for _, root := range cfg.Roots {
+		rootTypes, err := listContentTypes(root.Path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		for _, typeName := range rootTypes {
+			if !seen[typeName] {
+				seen[typeName] = true
+				types = append(types, typeName)
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("none of the content roots exists: %s", rootPaths(cfg))
+	}
+	sort.Strings(types)
+	return types, nil
+}
+
+/*
+Versions of the type merged across all roots, together with the name of the root which serves every version.
+The error is os.ErrNotExist if no root contains the type.
+*/
+func listAllContentVersions(cfg *moduleConfig, typeName string) ([]string, map[string]string, error) {
+	sources := make(map[string]string)
+	versions := []string{}
+	found := false
+	for _, root := range cfg.Roots {
+		rootVersions, err := listContentVersions(cfg, root.Path, typeName)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		found = true
+		for _, version := range rootVersions {
+			if _, ok := sources[version]; !ok {
+				sources[version] = root.Name
+				versions = append(versions, version)
+			}
+		}
+	}
+	if !found {
+		return nil, nil, os.ErrNotExist
+	}
+	sort.Strings(versions)
+	return versions, sources, nil
+}
+
+func rootPaths(cfg *moduleConfig) string {
+	paths := make([]string, 0, len(cfg.Roots))
+	for _, root := range cfg.Roots {
+		paths = append(paths, root.Path)
+	}
+	return strings.Join(paths, ", ")
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func useContentRoots(t *testing.T) (string, string) {
+	base, hotfix := t.TempDir(), t.TempDir()
+	setConfigValue(t, defaultFilePathEnvVarName, base)
+	setConfigValue(t, contentRootsEnvVarName, fmt.Sprintf(`[{"name": "hotfix", "path": %q}]`, hotfix))
+	return base, hotfix
+}
+
+func TestThatFirstRootContainingVersionWins(t *testing.T) {
+	useContentMetadata(t, map[contentKey]versionMetadata{})
+	base, hotfix := useContentRoots(t)
+	writeContentFile(t, base, "custom", "1.0.0", []byte(`{"from": "base"}`))
+	writeContentFile(t, base, "custom", "2.0.0", []byte(`{"from": "base"}`))
+	writeContentFile(t, hotfix, "custom", "1.0.0", []byte(`{"from": "hotfix"}`))
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "1.0.0", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"from": "hotfix"}`, *unmarshalResponse(res).Content)
+	res, err = RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "2.0.0", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"from": "base"}`, *unmarshalResponse(res).Content)
+}
+
+func TestThatListingMergesRootsWithSources(t *testing.T) {
+	useContentMetadata(t, map[contentKey]versionMetadata{})
+	base, hotfix := useContentRoots(t)
+	writeContentFile(t, base, "custom", "1.0.0", []byte(`{}`))
+	writeContentFile(t, base, "custom", "2.0.0", []byte(`{}`))
+	writeContentFile(t, hotfix, "custom", "1.0.0", []byte(`{}`))
+	writeContentFile(t, hotfix, "events", "halloween", []byte(`{}`))
+	db, _ := createDbMock()
+
+	res, err := RpcFileList(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), "")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"types": [
+		{"type": "custom", "versions": ["1.0.0", "2.0.0"], "sources": {"1.0.0": "hotfix", "2.0.0": "default"}},
+		{"type": "events", "versions": ["halloween"], "sources": {"halloween": "hotfix"}}
+	]}`, res)
+}
+
+func TestThatMissingRootIsSkipped(t *testing.T) {
+	useContentMetadata(t, map[contentKey]versionMetadata{})
+	setConfigValue(t, contentRootsEnvVarName, `[{"name": "hotfix", "path": "./missing"}]`)
+	db, _ := createDbMock()
+
+	_, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("core", "1.0.0", nil))
+	assert.NoError(t, err)
+}
+
+func TestThatDeletionRemovesVersionFromAllRoots(t *testing.T) {
+	useContentMetadata(t, map[contentKey]versionMetadata{})
+	base, hotfix := useContentRoots(t)
+	writeContentFile(t, base, "custom", "5.0.0", []byte(`{"custom": "5.0.0"}`))
+	writeContentFile(t, hotfix, "custom", "5.0.0", []byte(`{"custom": "5.0.0"}`))
+	db, dbMock := createDbMock()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("insert into downloader_content_versions").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("insert into downloader_audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+
+	_, err := RpcDownloaderDelete(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom", "version": "5.0.0"}`)
+	assert.NoError(t, err)
+	for _, root := range []string{base, hotfix} {
+		_, err = os.Stat(filepath.Join(root, "custom", "5.0.0.json"))
+		assert.True(t, os.IsNotExist(err))
+	}
+}
+
+func TestThatWrongRootsAreRejected(t *testing.T) {
+	for value, expected := range map[string]string{
+		`[{"name": "hotfix", "path": ""}]`:                           "root `hotfix`: `path` must not be empty",
+		`[{"name": "a", "path": "/a"}, {"name": "a", "path": "/b"}]`: "root `a` is listed twice",
+		`[{"name": "default", "path": "/a"}]`:                        "root name `default` is reserved for `default_file_path`",
+		`[{"name": "../a", "path": "/a"}]`:                           "root 0: `name` field must not contain /",
+	} {
+		_, err := loadConfig(testEnvWith(contentRootsEnvVarName, value))
+		assert.EqualError(t, err, "wrong `content_roots`: "+expected)
+	}
+}
+
+func TestThatDefaultRootCanBeListedExplicitly(t *testing.T) {
+	cfg, err := loadConfig(testEnvWith(contentRootsEnvVarName, `[{"name": "base", "path": "test_data"}, {"name": "hotfix", "path": "/hotfix"}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []contentRoot{{Name: "base", Path: "test_data"}, {Name: "hotfix", Path: "/hotfix"}}, cfg.Roots)
+}
+
+func TestThatVersionShadowedByAnotherRootIsNotPublished(t *testing.T) {
+	useContentMetadata(t, map[contentKey]versionMetadata{})
+	base, hotfix := useContentRoots(t)
+	writeContentFile(t, hotfix, "custom", "5.0.0", []byte(`{"from": "hotfix"}`))
+	db, dbMock := createDbMock()
+
+	_, err := RpcDownloaderPublish(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t),
+		`{"type": "custom", "version": "5.0.0", "content": "{}", "overwrite": true}`)
+	assert.EqualError(t, err, "Version `5.0.0` of `custom` is served from the `hotfix` root, remove it there first")
+	assertErrorCode(t, err, failedPreconditionCode)
+	_, err = os.Stat(filepath.Join(base, "custom", "5.0.0.json"))
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestThatPartialDeletionKeepsTombstone(t *testing.T) {
+	useContentMetadata(t, map[contentKey]versionMetadata{})
+	base, hotfix := useContentRoots(t)
+	writeContentFile(t, base, "custom", "5.0.0", []byte(`{"custom": "5.0.0"}`))
+	// A non-empty directory in place of the file can't be removed.
+	blocked := filepath.Join(hotfix, "custom", "5.0.0.json")
+	assert.NoError(t, os.MkdirAll(filepath.Join(blocked, "nested"), 0o700))
+	db, dbMock := createDbMock()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("insert into downloader_content_versions").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("insert into downloader_audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+
+	_, err := RpcDownloaderDelete(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom", "version": "5.0.0"}`)
+	assert.EqualError(t, err, "Version `5.0.0` of `custom` is deleted, but some of its files can't be removed: "+blocked)
+	assertErrorCode(t, err, internalErrorCode)
+	_, err = os.Stat(filepath.Join(base, "custom", "5.0.0.json"))
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
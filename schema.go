@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const contentSchemasEnvVarName = "content_schemas"
+
+// Stored next to versions of the type, the leading underscore makes it impossible to download it as a version.
+const schemaFileName = "_schema.json"
+
+// Content with a lot of mistakes would produce a huge error message otherwise.
+const maxSchemaErrors = 20
+
+/*
+Returns the schema of the type: `<type>/_schema.json` takes precedence over the `content_schemas` env var,
+so the schema can be updated together with the content. The file is taken from the first root which contains it,
+the same way as versions. Returns nil if the type has no schema.
+*/
+func loadContentSchema(cfg *moduleConfig, typeName string) (interface{}, error) {
+	for _, root := range cfg.Roots {
+		raw, err := os.ReadFile(filepath.Join(root.Path, typeName, schemaFileName))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return parseContentSchema(typeName, raw)
+	}
+	schemas := cfg.ContentSchemas
+	if schema, ok := schemas[typeName]; ok {
+		return schema, nil
+	}
+	return schemas[anyTypeKey], nil
+}
+
+func parseContentSchemas(value string) (map[string]interface{}, error) {
+	var rawSchemas map[string]json.RawMessage
+	err := json.Unmarshal([]byte(value), &rawSchemas)
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string]interface{}, len(rawSchemas))
+	for typeName, raw := range rawSchemas {
+		schemas[typeName], err = parseContentSchema(typeName, raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return schemas, nil
+}
+
+func parseContentSchema(typeName string, raw []byte) (interface{}, error) {
+	schema, err := decodeJson(raw)
+	if err != nil {
+		return nil, fmt.Errorf("schema of %s is not a valid JSON: %w", typeName, err)
+	}
+	switch schema.(type) {
+	case bool, map[string]interface{}:
+	default:
+		return nil, fmt.Errorf("schema of %s must be an object or a boolean", typeName)
+	}
+	if err = checkSchemaKeywords(schema, ""); err != nil {
+		return nil, fmt.Errorf("schema of %s is not supported: %w", typeName, err)
+	}
+	return schema, nil
+}
+
+// Keywords understood by validateValue. Unknown keywords are rejected, otherwise a schema would silently accept content
+// which it's supposed to refuse.
+var supportedSchemaKeywords = map[string]bool{
+	"type": true, "enum": true, "const": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true,
+	"minLength": true, "maxLength": true, "pattern": true,
+	"properties": true, "required": true, "additionalProperties": true,
+	"items": true, "minItems": true, "maxItems": true, "uniqueItems": true,
+	"allOf": true, "anyOf": true, "oneOf": true, "not": true,
+}
+
+// Annotations don't affect validation, so they are allowed to keep schemas generated by other tools usable.
+var schemaAnnotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+// Checks the schema and all its subschemas, the error contains the JSON pointer of the offending keyword.
+func checkSchemaKeywords(schema interface{}, path string) error {
+	if _, ok := schema.(bool); ok {
+		return nil
+	}
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s: must be an object or a boolean", path)
+	}
+	keywords := make([]string, 0, len(s))
+	for keyword := range s {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	for _, keyword := range keywords {
+		keywordPath := path + "/" + escapeJsonPointer(keyword)
+		if !supportedSchemaKeywords[keyword] && !schemaAnnotations[keyword] {
+			return fmt.Errorf("%s: unsupported keyword", keywordPath)
+		}
+		var err error
+		switch keyword {
+		case "properties":
+			properties, ok := s[keyword].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: must be an object", keywordPath)
+			}
+			err = checkSchemaMap(properties, keywordPath)
+		case "items":
+			if _, ok := s[keyword].([]interface{}); ok {
+				return fmt.Errorf("%s: only a single schema is supported", keywordPath)
+			}
+			err = checkSchemaKeywords(s[keyword], keywordPath)
+		case "additionalProperties", "not":
+			err = checkSchemaKeywords(s[keyword], keywordPath)
+		case "allOf", "anyOf", "oneOf":
+			subschemas, ok := s[keyword].([]interface{})
+			if !ok {
+				return fmt.Errorf("%s: must be an array", keywordPath)
+			}
+			for i, subschema := range subschemas {
+				if err = checkSchemaKeywords(subschema, keywordPath+"/"+strconv.Itoa(i)); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkSchemaMap(schemas map[string]interface{}, path string) error {
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := checkSchemaKeywords(schemas[name], path+"/"+escapeJsonPointer(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Numbers are decoded as json.Number, so error messages show them as they are written. Limits and equality
+are checked on float64 values, so integers above 2^53 may be considered equal.
+*/
+func decodeJson(content []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON document")
+	}
+	return value, nil
+}
+
+/*
+Validates the content against a JSON Schema and returns the list of violations, each one is prefixed by
+the JSON pointer of the invalid value. Only the commonly used subset of the specification is supported:
+type, enum, const, numeric and length limits, pattern, properties, required, additionalProperties, items,
+uniqueItems, allOf, anyOf, oneOf and not. Schemas with other keywords, including $ref, are rejected on load.
+*/
+func validateContent(schema interface{}, content []byte) []string {
+	value, err := decodeJson(content)
+	if err != nil {
+		return []string{fmt.Sprintf("/: not a valid JSON document: %v", err)}
+	}
+	var errs []string
+	validateValue(schema, value, "", &errs)
+	if len(errs) > maxSchemaErrors {
+		errs = append(errs[:maxSchemaErrors], fmt.Sprintf("and %d more errors", len(errs)-maxSchemaErrors))
+	}
+	return errs
+}
+
+func validateValue(schema interface{}, value interface{}, path string, errs *[]string) {
+	fail := func(format string, args ...interface{}) {
+		location := path
+		if location == "" {
+			location = "/"
+		}
+		*errs = append(*errs, location+": "+fmt.Sprintf(format, args...))
+	}
+
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			fail("no value is allowed")
+		}
+		return
+	case map[string]interface{}:
+		schema := s
+		if types, ok := schema["type"]; ok && !hasJsonType(value, types) {
+			fail("must be of type %s", describeJsonTypes(types))
+			// Other keywords would report confusing errors for a value of a wrong type.
+			return
+		}
+		if options, ok := schema["enum"].([]interface{}); ok && !containsJsonValue(options, value) {
+			fail("must be one of %s", encodeJson(options))
+		}
+		if expected, ok := schema["const"]; ok && !jsonEqual(expected, value) {
+			fail("must be equal to %s", encodeJson(expected))
+		}
+
+		switch v := value.(type) {
+		case json.Number:
+			validateNumber(schema, v, fail)
+		case string:
+			validateString(schema, v, fail)
+		case []interface{}:
+			validateArray(schema, v, path, errs, fail)
+		case map[string]interface{}:
+			validateObject(schema, v, path, errs, fail)
+		}
+
+		if subschemas, ok := schema["allOf"].([]interface{}); ok {
+			for _, subschema := range subschemas {
+				validateValue(subschema, value, path, errs)
+			}
+		}
+		if subschemas, ok := schema["anyOf"].([]interface{}); ok && countMatchingSchemas(subschemas, value) == 0 {
+			fail("must match at least one of anyOf schemas")
+		}
+		if subschemas, ok := schema["oneOf"].([]interface{}); ok {
+			if matched := countMatchingSchemas(subschemas, value); matched != 1 {
+				fail("must match exactly one of oneOf schemas, matched %d", matched)
+			}
+		}
+		if subschema, ok := schema["not"]; ok && countMatchingSchemas([]interface{}{subschema}, value) == 1 {
+			fail("must not match the schema in not")
+		}
+	}
+}
+
+func validateNumber(schema map[string]interface{}, value json.Number, fail func(string, ...interface{})) {
+	number, err := value.Float64()
+	if err != nil {
+		fail("not a valid number")
+		return
+	}
+	if limit, ok := schemaNumber(schema, "minimum"); ok && number < limit {
+		fail("must be >= %v", limit)
+	}
+	if limit, ok := schemaNumber(schema, "maximum"); ok && number > limit {
+		fail("must be <= %v", limit)
+	}
+	if limit, ok := schemaNumber(schema, "exclusiveMinimum"); ok && number <= limit {
+		fail("must be > %v", limit)
+	}
+	if limit, ok := schemaNumber(schema, "exclusiveMaximum"); ok && number >= limit {
+		fail("must be < %v", limit)
+	}
+}
+
+func validateString(schema map[string]interface{}, value string, fail func(string, ...interface{})) {
+	length := float64(utf8.RuneCountInString(value))
+	if limit, ok := schemaNumber(schema, "minLength"); ok && length < limit {
+		fail("must be at least %v characters long", limit)
+	}
+	if limit, ok := schemaNumber(schema, "maxLength"); ok && length > limit {
+		fail("must be at most %v characters long", limit)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			fail("schema has an invalid pattern %q", pattern)
+		} else if !re.MatchString(value) {
+			fail("must match pattern %q", pattern)
+		}
+	}
+}
+
+func validateArray(schema map[string]interface{}, value []interface{}, path string, errs *[]string, fail func(string, ...interface{})) {
+	if limit, ok := schemaNumber(schema, "minItems"); ok && float64(len(value)) < limit {
+		fail("must contain at least %v items", limit)
+	}
+	if limit, ok := schemaNumber(schema, "maxItems"); ok && float64(len(value)) > limit {
+		fail("must contain at most %v items", limit)
+	}
+	if unique, ok := schema["uniqueItems"].(bool); ok && unique {
+		for i := range value {
+			for j := 0; j < i; j++ {
+				if jsonEqual(value[i], value[j]) {
+					fail("items %d and %d are equal", j, i)
+				}
+			}
+		}
+	}
+	if items, ok := schema["items"]; ok {
+		for i, item := range value {
+			validateValue(items, item, path+"/"+strconv.Itoa(i), errs)
+		}
+	}
+}
+
+func validateObject(schema map[string]interface{}, value map[string]interface{}, path string, errs *[]string, fail func(string, ...interface{})) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, exists := value[name]; !exists {
+					fail("missing required property %q", name)
+				}
+			}
+		}
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	additional, hasAdditional := schema["additionalProperties"]
+	// Properties are validated in a stable order, so the same content always produces the same message.
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		propertyPath := path + "/" + escapeJsonPointer(name)
+		if propertySchema, ok := properties[name]; ok {
+			validateValue(propertySchema, value[name], propertyPath, errs)
+		} else if hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				*errs = append(*errs, propertyPath+": unexpected property")
+			} else {
+				validateValue(additional, value[name], propertyPath, errs)
+			}
+		}
+	}
+}
+
+func countMatchingSchemas(schemas []interface{}, value interface{}) int {
+	matched := 0
+	for _, schema := range schemas {
+		var errs []string
+		validateValue(schema, value, "", &errs)
+		if len(errs) == 0 {
+			matched++
+		}
+	}
+	return matched
+}
+
+func schemaNumber(schema map[string]interface{}, keyword string) (float64, bool) {
+	number, ok := schema[keyword].(json.Number)
+	if !ok {
+		return 0, false
+	}
+	value, err := number.Float64()
+	return value, err == nil
+}
+
+func hasJsonType(value interface{}, types interface{}) bool {
+	switch t := types.(type) {
+	case string:
+		return isJsonType(value, t)
+	case []interface{}:
+		for _, name := range t {
+			if name, ok := name.(string); ok && isJsonType(value, name) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func isJsonType(value interface{}, name string) bool {
+	switch v := value.(type) {
+	case nil:
+		return name == "null"
+	case bool:
+		return name == "boolean"
+	case string:
+		return name == "string"
+	case []interface{}:
+		return name == "array"
+	case map[string]interface{}:
+		return name == "object"
+	case json.Number:
+		if name == "number" {
+			return true
+		}
+		number, err := v.Float64()
+		return name == "integer" && err == nil && number == math.Trunc(number)
+	}
+	return false
+}
+
+func describeJsonTypes(types interface{}) string {
+	if names, ok := types.([]interface{}); ok {
+		parts := make([]string, 0, len(names))
+		for _, name := range names {
+			parts = append(parts, fmt.Sprint(name))
+		}
+		return strings.Join(parts, " or ")
+	}
+	return fmt.Sprint(types)
+}
+
+func containsJsonValue(options []interface{}, value interface{}) bool {
+	for _, option := range options {
+		if jsonEqual(option, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compares decoded JSON values, numbers are equal if their values are equal, e.g. 1 and 1.0.
+func jsonEqual(a interface{}, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		xf, errX := x.Float64()
+		yf, errY := y.Float64()
+		return errX == nil && errY == nil && xf == yf
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, exists := y[key]
+			if !exists || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+func encodeJson(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+// See RFC 6901, section 3.
+func escapeJsonPointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
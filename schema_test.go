@@ -0,0 +1,95 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestThatContentIsValidatedAgainstSchema(t *testing.T) {
+	schema, err := decodeJson([]byte(`{
+		"type": "object",
+		"required": ["name", "price"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "pattern": "^[a-z]+$"},
+			"price": {"type": "integer", "minimum": 0},
+			"rarity": {"enum": ["common", "rare"]},
+			"tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": true, "maxItems": 3},
+			"a/b": {"oneOf": [{"type": "string"}, {"type": "number"}]}
+		}
+	}`))
+	assert.NoError(t, err)
+
+	for content, expected := range map[string][]string{
+		`{"name": "sword", "price": 10, "rarity": "rare", "tags": ["melee"], "a/b": 1.5}`: nil,
+		`{"name": "sword", "price": 10.0}`:                                                nil,
+		`{"name": "Sword", "price": -1}`: {
+			`/name: must match pattern "^[a-z]+$"`,
+			`/price: must be >= 0`,
+		},
+		`{"price": 1.5, "rarity": "epic", "extra": true}`: {
+			`/: missing required property "name"`,
+			`/extra: unexpected property`,
+			`/price: must be of type integer`,
+			`/rarity: must be one of ["common","rare"]`,
+		},
+		`{"name": "a", "price": 1, "tags": ["x", 1, "x"], "a/b": null}`: {
+			`/a~1b: must match exactly one of oneOf schemas, matched 0`,
+			`/tags: items 0 and 2 are equal`,
+			`/tags/1: must be of type string`,
+		},
+		`[]`:         {`/: must be of type object`},
+		`{"name": }`: {`/: not a valid JSON document: invalid character '}' looking for beginning of value`},
+	} {
+		assert.Equal(t, expected, validateContent(schema, []byte(content)), content)
+	}
+}
+
+func TestThatNumberOfSchemaErrorsIsLimited(t *testing.T) {
+	errs := validateContent(map[string]interface{}{"items": false}, []byte(`[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,21,22]`))
+	assert.Len(t, errs, maxSchemaErrors+1)
+	assert.Equal(t, "and 2 more errors", errs[maxSchemaErrors])
+}
+
+func TestThatSchemaFileTakesPrecedenceOverConfig(t *testing.T) {
+	root := t.TempDir()
+	setConfigValue(t, defaultFilePathEnvVarName, root)
+	setConfigValue(t, contentSchemasEnvVarName, `{"custom": {"type": "array"}, "*": {"type": "object"}}`)
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "custom"), 0o700))
+
+	schema, err := loadContentSchema(currentConfig(), "custom")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"type": "array"}, schema)
+	schema, err = loadContentSchema(currentConfig(), "core")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"type": "object"}, schema)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "custom", schemaFileName), []byte(`{"type": "string"}`), 0o600))
+	schema, err = loadContentSchema(currentConfig(), "custom")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"type": "string"}, schema)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "custom", schemaFileName), []byte(`"string"`), 0o600))
+	_, err = loadContentSchema(currentConfig(), "custom")
+	assert.Error(t, err)
+}
+
+func TestThatSchemaWithUnsupportedKeywordsIsRejected(t *testing.T) {
+	for schema, expected := range map[string]string{
+		`{"$ref": "#/$defs/item"}`:                           "/$ref: unsupported keyword",
+		`{"properties": {"a/b": {"format": "email"}}}`:       "/properties/a~1b/format: unsupported keyword",
+		`{"anyOf": [{"type": "string"}, {"multipleOf": 2}]}`: "/anyOf/1/multipleOf: unsupported keyword",
+		`{"items": {"additionalProperties": {"if": {}}}}`:    "/items/additionalProperties/if: unsupported keyword",
+		`{"items": [{"type": "string"}]}`:                    "/items: only a single schema is supported",
+		`{"not": "string"}`:                                  "/not: must be an object or a boolean",
+		`[]`:                                                 "schema of custom must be an object or a boolean",
+	} {
+		_, err := parseContentSchema("custom", []byte(schema))
+		assert.ErrorContains(t, err, expected, schema)
+	}
+
+	_, err := parseContentSchema("custom", []byte(`{"$schema": "https://json-schema.org/draft/2020-12/schema", "title": "Custom", "type": "object"}`))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"io"
+	"os"
+)
+
+const maxFileSizesEnvVarName string = "max_file_sizes"
+const maxResponseSizeEnvVarName string = "max_response_size"
+
+const defaultMaxFileSize int64 = 10 << 20
+
+// Content is escaped in JSON, so the response may be noticeably bigger than the file.
+const defaultMaxResponseSize int64 = 2 * defaultMaxFileSize
+
+var errFileTooLarge = errors.New("file is too large")
+
+/*
+The `max_file_sizes` env var contains a JSON object where keys are types (`*` for types without their own limit)
+and values are maximum sizes of files in bytes, e.g. `{"*": 1048576, "ugc": 65536}`.
+*/
+func parseMaxFileSizes(value string) (map[string]int64, error) {
+	var sizes map[string]int64
+	err := json.Unmarshal([]byte(value), &sizes)
+	if err != nil {
+		return nil, err
+	}
+	for typeName, size := range sizes {
+		if size <= 0 {
+			return nil, fmt.Errorf("`%s`: size must be positive", typeName)
+		}
+	}
+	return sizes, nil
+}
+
+func maxFileSizeFor(sizes map[string]int64, typeName string) int64 {
+	if size, ok := sizes[typeName]; ok {
+		return size
+	}
+	if size, ok := sizes[anyTypeKey]; ok {
+		return size
+	}
+	return defaultMaxFileSize
+}
+
+/*
+The size is checked before reading, so a huge file is never loaded into memory. The file may still grow
+between the check and the read, that's why the read itself is limited too.
+*/
+func readFileWithLimit(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > limit {
+		return nil, errFileTooLarge
+	}
+	content, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > limit {
+		return nil, errFileTooLarge
+	}
+	return content, nil
+}
+
+// There is no chunked download yet, so the errors tell clients what they can do instead.
+const tooLargeGuidance = "chunked download is not supported, split the content into several versions or ask the operators to raise the limit"
+
+func fileTooLargeError(typeName string, limit int64) error {
+	return runtime.NewError(fmt.Sprintf("File exceeds the maximum size of %d bytes allowed for `%s`: %s", limit, typeName, tooLargeGuidance), resourceExhaustedCode)
+}
+
+func responseTooLargeError(limit int64) error {
+	return runtime.NewError(fmt.Sprintf("Response exceeds the maximum size of %d bytes: %s", limit, tooLargeGuidance), resourceExhaustedCode)
+}
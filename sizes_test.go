@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestThatFileLargerThanLimitOfTypeIsNotRead(t *testing.T) {
+	setConfigValue(t, maxFileSizesEnvVarName, `{"*": 1024, "custom": 10}`)
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "5.0.0", nil))
+	assert.EqualError(t, err, "File exceeds the maximum size of 10 bytes allowed for `custom`: "+tooLargeGuidance)
+	assertErrorCode(t, err, resourceExhaustedCode)
+	assert.Equal(t, "{}", res)
+
+	_, err = RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("core", "1.0.0", nil))
+	assert.NoError(t, err)
+}
+
+func TestThatResponseLargerThanLimitIsRejected(t *testing.T) {
+	setConfigValue(t, maxResponseSizeEnvVarName, "64")
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloader(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), buildPayload("custom", "5.0.0", nil))
+	assert.EqualError(t, err, "Response exceeds the maximum size of 64 bytes: chunked download is not supported, "+
+		"split the content into several versions or ask the operators to raise the limit")
+	assert.Equal(t, "{}", res)
+}
+
+func TestThatWrongMaxFileSizeIsRejected(t *testing.T) {
+	_, err := loadConfig(testEnvWith(maxFileSizesEnvVarName, `{"custom": -1}`))
+	assert.EqualError(t, err, "wrong `max_file_sizes`: `custom`: size must be positive")
+}
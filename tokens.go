@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"strings"
+	"time"
+)
+
+const downloadTokenSecretEnvVarName string = "download_token_secret"
+
+const defaultDownloadTokenTtl = 5 * time.Minute
+const maxDownloadTokenTtl = 24 * time.Hour
+
+type DownloadTokenRequest struct {
+	Type       string  `json:"type"`
+	Version    string  `json:"version"`
+	UserId     *string `json:"user_id,omitempty"`
+	TtlSeconds *int64  `json:"ttl_seconds,omitempty"`
+}
+
+type DownloadTokenResponse struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type downloadTokenClaims struct {
+	Type      string `json:"type"`
+	Version   string `json:"version"`
+	UserId    string `json:"user_id,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+/*
+Issues a token which grants access to a specific type and version (and optionally only to a specific user)
+until it expires. A token replaces access control checks, so the RPC is available only to server-to-server calls,
+e.g. to a server-authoritative match which hands out a premium level to its participants.
+*/
+func RpcFileDownloadToken(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	err := checkServerToServer(ctx)
+	if err != nil {
+		return "{}", err
+	}
+	var req DownloadTokenRequest
+	err = json.Unmarshal([]byte(payload), &req)
+	if err != nil {
+		logger.Info("Unable to deserialize request %v", err)
+		return "{}", runtime.NewError("Unable to deserialize request", invalidArgumentCode)
+	}
+	err = validateRequest(DownloaderRequest{Type: req.Type, Version: req.Version})
+	if err != nil {
+		return "{}", err
+	}
+	ttl := defaultDownloadTokenTtl
+	if req.TtlSeconds != nil {
+		ttl = time.Duration(*req.TtlSeconds) * time.Second
+		if ttl <= 0 || ttl > maxDownloadTokenTtl {
+			return "{}", runtime.NewError(fmt.Sprintf("`ttl_seconds` must be between 1 and %d", int64(maxDownloadTokenTtl.Seconds())), invalidArgumentCode)
+		}
+	}
+	secret, err := downloadTokenSecret(currentConfig())
+	if err != nil {
+		return "{}", err
+	}
+
+	claims := downloadTokenClaims{Type: req.Type, Version: req.Version, ExpiresAt: time.Now().Add(ttl).Unix()}
+	if req.UserId != nil {
+		claims.UserId = *req.UserId
+	}
+	token, err := signDownloadToken(secret, claims)
+	if err != nil {
+		return "{}", err
+	}
+	respStr, err := json.Marshal(DownloadTokenResponse{Token: token, ExpiresAt: claims.ExpiresAt})
+	if err != nil {
+		return "{}", err
+	}
+	return string(respStr[:]), nil
+}
+
+// Tokens are optional, so the secret is not required at startup. Without it tokens fail until the operators set it.
+func downloadTokenSecret(cfg *moduleConfig) (string, error) {
+	secret := cfg.DownloadTokenSecret
+	if secret == "" {
+		return "", runtime.NewError(fmt.Sprintf("Download tokens are not configured, `%s` is not set", downloadTokenSecretEnvVarName), failedPreconditionCode)
+	}
+	return secret, nil
+}
+
+// A token is `<claims>.<signature>`, where claims are JSON and the signature is HMAC-SHA256 of them, both in base64url.
+func signDownloadToken(secret string, claims downloadTokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	return encodedPayload + "." + base64.RawURLEncoding.EncodeToString(downloadTokenSignature(secret, encodedPayload)), nil
+}
+
+func downloadTokenSignature(secret string, encodedPayload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(encodedPayload))
+	return mac.Sum(nil)
+}
+
+func checkDownloadToken(ctx context.Context, cfg *moduleConfig, token string, req DownloaderRequest, now time.Time) error {
+	secret, err := downloadTokenSecret(cfg)
+	if err != nil {
+		return err
+	}
+	claims, ok := verifyDownloadToken(secret, token)
+	if !ok {
+		return runtime.NewError("Download token is invalid", permissionDeniedCode)
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return runtime.NewError("Download token has expired", permissionDeniedCode)
+	}
+	userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if claims.Type != req.Type || claims.Version != req.Version || (claims.UserId != "" && claims.UserId != userId) {
+		return runtime.NewError("Download token does not grant access to the requested file", permissionDeniedCode)
+	}
+	return nil
+}
+
+func verifyDownloadToken(secret string, token string) (downloadTokenClaims, bool) {
+	var claims downloadTokenClaims
+	encodedPayload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return claims, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, downloadTokenSignature(secret, encodedPayload)) {
+		return claims, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return claims, false
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return claims, false
+	}
+	return claims, true
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestThatTokenGrantsAccessToRestrictedType(t *testing.T) {
+	setConfigValue(t, downloadTokenSecretEnvVarName, "secret")
+	setConfigValue(t, accessControlEnvVarName, `{"custom": {"access": "restricted", "groups": ["premium"]}}`)
+	db, _ := createDbMock()
+	userId := "user-1"
+	token := issueTokenForTest(t, `{"type": "custom", "version": "5.0.0", "user_id": "user-1"}`)
+
+	res, err := RpcFileDownloader(userContext(userId), buildLoggerMock(), db, buildNakamaModuleMock(t), buildTokenPayload("custom", "5.0.0", token))
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"custom\": \"5.0.0\"}", *unmarshalResponse(res).Content)
+}
+
+func TestThatTokenIsBoundToUserTypeAndVersion(t *testing.T) {
+	setConfigValue(t, downloadTokenSecretEnvVarName, "secret")
+	db, _ := createDbMock()
+	token := issueTokenForTest(t, `{"type": "custom", "version": "5.0.0", "user_id": "user-1"}`)
+
+	_, err := RpcFileDownloader(userContext("user-2"), buildLoggerMock(), db, buildNakamaModuleMock(t), buildTokenPayload("custom", "5.0.0", token))
+	assertErrorCode(t, err, permissionDeniedCode)
+	_, err = RpcFileDownloader(userContext("user-1"), buildLoggerMock(), db, buildNakamaModuleMock(t), buildTokenPayload("core", "1.0.0", token))
+	assertErrorCode(t, err, permissionDeniedCode)
+}
+
+func TestThatExpiredTokenIsRejected(t *testing.T) {
+	setConfigValue(t, downloadTokenSecretEnvVarName, "secret")
+	token, err := signDownloadToken("secret", downloadTokenClaims{Type: "custom", Version: "5.0.0", ExpiresAt: 100})
+	assert.NoError(t, err)
+	req := DownloaderRequest{Type: "custom", Version: "5.0.0"}
+
+	assert.NoError(t, checkDownloadToken(context.Background(), currentConfig(), token, req, time.Unix(99, 0)))
+	assert.EqualError(t, checkDownloadToken(context.Background(), currentConfig(), token, req, time.Unix(100, 0)), "Download token has expired")
+}
+
+func TestThatTokenSignedWithAnotherSecretIsRejected(t *testing.T) {
+	setConfigValue(t, downloadTokenSecretEnvVarName, "secret")
+	token, err := signDownloadToken("another secret", downloadTokenClaims{Type: "custom", Version: "5.0.0", ExpiresAt: 100})
+	assert.NoError(t, err)
+
+	err = checkDownloadToken(context.Background(), currentConfig(), token, DownloaderRequest{Type: "custom", Version: "5.0.0"}, time.Unix(0, 0))
+	assert.EqualError(t, err, "Download token is invalid")
+}
+
+func TestThatTokensFailWithoutSecret(t *testing.T) {
+	db, _ := createDbMock()
+
+	_, err := RpcFileDownloadToken(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom", "version": "5.0.0"}`)
+	assertErrorCode(t, err, failedPreconditionCode)
+	_, err = RpcFileDownloader(userContext("user-1"), buildLoggerMock(), db, buildNakamaModuleMock(t), buildTokenPayload("custom", "5.0.0", "token"))
+	assertErrorCode(t, err, failedPreconditionCode)
+}
+
+func TestThatTokenIsNotIssuedToUsers(t *testing.T) {
+	setConfigValue(t, downloadTokenSecretEnvVarName, "secret")
+	db, _ := createDbMock()
+
+	res, err := RpcFileDownloadToken(userContext("user-1"), buildLoggerMock(), db, buildNakamaModuleMock(t), `{"type": "custom", "version": "5.0.0"}`)
+	assertErrorCode(t, err, permissionDeniedCode)
+	assert.Equal(t, "{}", res)
+}
+
+func issueTokenForTest(t *testing.T, payload string) string {
+	db, _ := createDbMock()
+	res, err := RpcFileDownloadToken(context.Background(), buildLoggerMock(), db, buildNakamaModuleMock(t), payload)
+	assert.NoError(t, err)
+	var resp DownloadTokenResponse
+	assert.NoError(t, json.Unmarshal([]byte(res), &resp))
+	return resp.Token
+}
+
+func buildTokenPayload(typeName string, version string, token string) string {
+	payload, err := json.Marshal(DownloaderRequest{Type: typeName, Version: version, Token: &token})
+	if err != nil {
+		panic(err)
+	}
+	return string(payload[:])
+}